@@ -137,3 +137,23 @@ func TestMissingServerListFailsFast(t *testing.T) {
 		t.Errorf("expected error mentioning 'server list', got:\n%s", out)
 	}
 }
+
+func TestTemplateLint(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.tpl")
+	bad := filepath.Join(dir, "bad.tpl")
+	os.WriteFile(good, []byte("a.example A=1.1.1.1\nb.example NXDOMAIN\nc.example SERVFAIL\n"), 0644)
+	os.WriteFile(bad, []byte("a.example A=1.1.1.1\nb.example NXDOMAIN\na.example NXDOMAIN\n"), 0644)
+
+	out, code := runCLI(t, "template", "lint", good)
+	if code != 0 {
+		t.Fatalf("expected exit‑code 0 on clean template, got %d\n%s", code, out)
+	}
+	out, code = runCLI(t, "template", "lint", bad)
+	if code == 0 {
+		t.Fatalf("expected non‑zero exit‑code on bad template\n%s", out)
+	}
+	if !bytes.Contains([]byte(out), []byte(bad+":3: duplicate domain")) {
+		t.Errorf("expected duplicate domain issue with position, got:\n%s", out)
+	}
+}
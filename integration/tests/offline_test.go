@@ -0,0 +1,750 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/fakedns"
+	"github.com/nil0x42/dnsanity/internal/report"
+)
+
+// TestIntegrationOffline runs dnsanity end to end (trusted step included)
+// against scripted fake DNS servers on loopback, so it needs no network.
+func TestIntegrationOffline(t *testing.T) {
+	zone := fakedns.Zone{
+		"a.test":     {A: []string{"192.0.2.1"}},
+		"cname.test": {CNAME: []string{"a.test"}, A: []string{"192.0.2.1"}},
+	}
+	trusted, err := fakedns.StartFarm(zone, fakedns.Script{}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start trusted servers: %v", err)
+	}
+	defer trusted.Close()
+
+	servers := []struct {
+		name   string
+		script fakedns.Script
+		valid  bool
+	}{
+		{"correct", fakedns.Script{}, true},
+		{"delay", fakedns.Script{Delay: 200 * time.Millisecond}, true},
+		{"hijack", fakedns.Script{Hijack: "203.0.113.66"}, false},
+		{"nxredirect", fakedns.Script{NXRedirect: "203.0.113.77"}, false},
+		{"drop", fakedns.Script{Drop: true}, false},
+		{"refuse_after", fakedns.Script{RefuseAfter: 1}, false},
+		{"truncate", fakedns.Script{Truncate: true}, false},
+	}
+	var scripts []fakedns.Script
+	for _, srv := range servers {
+		scripts = append(scripts, srv.script)
+	}
+	untrusted, err := fakedns.StartFarm(zone, scripts...)
+	if err != nil {
+		t.Fatalf("Cannot start untrusted servers: %v", err)
+	}
+	defer untrusted.Close()
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	jsonPath := filepath.Join(dir, "out.jsonl")
+	invalidPath := filepath.Join(dir, "invalid.txt")
+	timeoutPath := filepath.Join(dir, "timeout.txt")
+	tpl := "a.test A=192.0.2.1\ncname.test CNAME=a.test. A=192.0.2.1\nnx.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+
+	out, code := runCLI(
+		t,
+		"-list", strings.Join(untrusted.Addrs(), ","),
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", strings.Join(trusted.Addrs(), ","),
+		"-trusted-timeout", "1",
+		"-timeout", "1",
+		"-ratelimit", "20",
+		"-o", outPath,
+		"-oJ", jsonPath,
+		"-o-invalid", invalidPath,
+		"-o-timeout", timeoutPath,
+	)
+	if code != 0 {
+		t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Cannot read output file: %v", err)
+	}
+	got := strings.Fields(string(data))
+	jsonData, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Cannot read -oJ file: %v", err)
+	}
+	results := map[string]report.ServerResult{}
+	for _, line := range strings.Split(strings.TrimSpace(string(jsonData)), "\n") {
+		var res report.ServerResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("invalid -oJ line %q: %v", line, err)
+		}
+		results[res.Server] = res
+	}
+	for i, srv := range servers {
+		addr := untrusted.Servers[i].Addr
+		if slices.Contains(got, addr) != srv.valid {
+			t.Errorf("%s server (%s): want valid=%v, output:\n%s",
+				srv.name, addr, srv.valid, data)
+		}
+		if untrusted.Servers[i].Queries() == 0 {
+			t.Errorf("%s server (%s) was never queried", srv.name, addr)
+		}
+		if res, ok := results[addr]; !ok || res.Valid != srv.valid ||
+			len(res.Checks) != 3 || res.Checks[0].Domain != "a.test" {
+			t.Errorf("%s server (%s): unexpected -oJ record %+v", srv.name, addr, res)
+		}
+	}
+	// rejected servers, with their first failed check
+	invalid, _ := os.ReadFile(invalidPath)
+	timeout, _ := os.ReadFile(timeoutPath)
+	hijack, drop := untrusted.Servers[2].Addr, untrusted.Servers[4].Addr
+	if !strings.Contains(string(invalid), hijack+" a.test A=203.0.113.66\n") {
+		t.Errorf("expected hijack server in -o-invalid file, got:\n%s", invalid)
+	}
+	if string(timeout) != drop+" a.test TIMEOUT\n" {
+		t.Errorf("expected only drop server in -o-timeout file, got:\n%s", timeout)
+	}
+	if n := len(strings.Split(strings.TrimSpace(string(invalid)), "\n")); n != 4 {
+		t.Errorf("expected 4 servers in -o-invalid file, got:\n%s", invalid)
+	}
+}
+
+// TestIntegrationOfflineTrustedQuorum checks that a hijacking TRUSTED
+// server fails template validation (with per-entry attribution), unless
+// -trusted-quorum is reached without it.
+func TestIntegrationOfflineTrustedQuorum(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone,
+		fakedns.Script{Hijack: "203.0.113.66"},
+		fakedns.Script{}, fakedns.Script{}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	bad := farm.Servers[0].Addr
+	trusted := strings.Join(farm.Addrs()[:3], ",")
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	args := []string{
+		"-list", farm.Servers[3].Addr,
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", trusted,
+		"-trusted-timeout", "1",
+		"-o", outPath,
+	}
+
+	out, code := runCLI(t, args...)
+	if code != 3 {
+		t.Fatalf("expected exit-code 3 with a hijacking TRUSTED server, got %d\n%s", code, out)
+	}
+	want := "a.test A=192.0.2.1 (2/3 passed) - failed on " + bad + " (A=203.0.113.66)"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected attribution %q, got:\n%s", want, out)
+	}
+
+	out, code = runCLI(t, append(args, "-trusted-quorum", "2")...)
+	if code != 0 {
+		t.Fatalf("expected success with -trusted-quorum 2, got %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "despite failures") || !strings.Contains(out, want) {
+		t.Errorf("expected partial failures report, got:\n%s", out)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil || !strings.Contains(string(data), farm.Servers[3].Addr) {
+		t.Errorf("expected %s in output file, got %q (%v)", farm.Servers[3].Addr, data, err)
+	}
+
+	// a repeated TRUSTED server is only counted once by the default quorum
+	good := farm.Servers[1].Addr + "," + farm.Servers[2].Addr
+	args[6] = good + "," + farm.Servers[1].Addr
+	out, code = runCLI(t, args...)
+	if code != 0 {
+		t.Fatalf("expected success with a repeated TRUSTED server, got %d\n%s", code, out)
+	}
+}
+
+// TestIntegrationOfflinePruneTemplate checks that -prune-template removes
+// a stale template entry and goes on (exit-code 4), unless less than
+// -min-template-entries would be left.
+func TestIntegrationOfflinePruneTemplate(t *testing.T) {
+	zone := fakedns.Zone{
+		"a.test":     {A: []string{"192.0.2.1"}},
+		"moved.test": {A: []string{"192.0.2.99"}},
+	}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	tpl := "a.test A=192.0.2.1\nmoved.test A=192.0.2.2\nnx.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	args := []string{
+		"-list", farm.Servers[1].Addr,
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-o", outPath,
+		"-prune-template",
+	}
+
+	out, code := runCLI(t, args...)
+	if code != 4 {
+		t.Fatalf("expected exit-code 4 with a pruned template, got %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Pruned 1/3 template entries") ||
+		!strings.Contains(out, "moved.test A=192.0.2.2 (0/1 passed)") {
+		t.Errorf("expected pruned entries report, got:\n%s", out)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil || !strings.Contains(string(data), farm.Servers[1].Addr) {
+		t.Errorf("expected %s in output file, got %q (%v)", farm.Servers[1].Addr, data, err)
+	}
+
+	out, code = runCLI(t, append(args, "-min-template-entries", "3")...)
+	if code != 3 {
+		t.Fatalf("expected exit-code 3 below -min-template-entries, got %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Can't prune: 2 entries would be left") {
+		t.Errorf("expected -min-template-entries error, got:\n%s", out)
+	}
+}
+
+// TestIntegrationOfflinePrefilter checks that -prefilter only sends one
+// probe to dead servers, counts them in the final report, and writes them
+// to -o-invalid file.
+func TestIntegrationOfflinePrefilter(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone,
+		fakedns.Script{}, fakedns.Script{}, fakedns.Script{Drop: true})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	trusted, alive, dead := farm.Servers[0], farm.Servers[1], farm.Servers[2]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	invalidPath := filepath.Join(dir, "invalid.txt")
+	tpl := "a.test A=192.0.2.1\nnx.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	run := func(list ...string) string {
+		t.Helper()
+		out, code := runCLI(t,
+			"-list", strings.Join(list, ","),
+			"-allow-special",
+			"-template", tplPath,
+			"-trusted-list", trusted.Addr,
+			"-trusted-timeout", "1",
+			"-timeout", "1",
+			"-max-attempts", "3",
+			"-o", outPath,
+			"-o-invalid", invalidPath,
+			"-prefilter",
+		)
+		if code != 0 {
+			t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+		}
+		return out
+	}
+
+	out := run(alive.Addr, dead.Addr)
+	if !strings.Contains(out, "Valid servers: 1/2 (50.0%), 1 dead (pre-filter)") {
+		t.Errorf("expected dead servers in final report, got:\n%s", out)
+	}
+	data, _ := os.ReadFile(outPath)
+	if got := strings.Fields(string(data)); !slices.Equal(got, []string{alive.Addr}) {
+		t.Errorf("expected only %s in output file, got %v", alive.Addr, got)
+	}
+	if n := dead.Queries(); n != 1 {
+		t.Errorf("expected a single probe to dead server, got %d queries", n)
+	}
+	data, _ = os.ReadFile(invalidPath)
+	if want := dead.Addr + " . TIMEOUT\n"; string(data) != want {
+		t.Errorf("-o-invalid file: got %q, want %q", data, want)
+	}
+
+	// no responsive server at all
+	out = run(dead.Addr)
+	if !strings.Contains(out, "Valid servers: 0/1 (0.0%), 1 dead (pre-filter)") {
+		t.Errorf("expected dead servers in final report, got:\n%s", out)
+	}
+}
+
+// TestIntegrationOfflinePrefilterInterrupted checks that servers left
+// unprobed by an interrupted -prefilter are reported as untested.
+func TestIntegrationOfflinePrefilterInterrupted(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	drop := fakedns.Script{Drop: true}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{}, drop, drop, drop)
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	list := farm.Addrs()[1:]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	untestedPath := filepath.Join(dir, "untested.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	out, code := runCLI(t,
+		"-list", strings.Join(list, ","),
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-prefilter",
+		"-prefilter-timeout", "2",
+		"-threads", "1",
+		"-max-poolsize", "1",
+		"-max-duration", "500ms",
+		"-o", filepath.Join(dir, "out.txt"),
+		"-o-untested", untestedPath,
+	)
+	if code != 0 {
+		t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Valid servers: 0/3 (0.0%), 0 dead (pre-filter), 3 untested") {
+		t.Errorf("expected unprobed servers in final report, got:\n%s", out)
+	}
+	data, _ := os.ReadFile(untestedPath)
+	got := strings.Fields(string(data))
+	slices.Sort(got)
+	want := slices.Clone(list)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("-o-untested file: got %v, want %v\n%s", got, want, out)
+	}
+}
+
+// TestIntegrationOfflineFastFail checks that a -fast-fail status drops
+// a server at once, without running its remaining checks.
+func TestIntegrationOfflineFastFail(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	closed := farm.Servers[1].Addr
+	farm.Servers[1].Close() // port closed: ECONNREFUSED
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	tpl := "a.test A=192.0.2.1\nb.test NXDOMAIN\nc.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	run := func(extra ...string) string {
+		t.Helper()
+		out, code := runCLI(t, append([]string{
+			"-list", closed,
+			"-allow-special",
+			"-template", tplPath,
+			"-trusted-list", farm.Servers[0].Addr,
+			"-trusted-timeout", "1",
+			"-timeout", "1",
+			"-max-mismatches", "3",
+			"-o", filepath.Join(dir, "out.txt"),
+			"-verbose",
+		}, extra...)...)
+		if code != 0 {
+			t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+		}
+		return out
+	}
+
+	if n := strings.Count(run(), "ECONNREFUSED"); n != 3 {
+		t.Skipf("expected 3 ECONNREFUSED answers without -fast-fail, got %d", n)
+	}
+	if n := strings.Count(run("-fast-fail", "ECONNREFUSED"), "ECONNREFUSED"); n != 1 {
+		t.Errorf("expected a single ECONNREFUSED answer with -fast-fail, got %d", n)
+	}
+}
+
+// TestIntegrationOfflineShardMerge splits a list across -shard runs,
+// then checks that `dnsanity merge` recombines their -state files.
+func TestIntegrationOfflineShardMerge(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	scripts := []fakedns.Script{{}} // trusted
+	for i := 0; i < 8; i++ {
+		scripts = append(scripts, fakedns.Script{}, fakedns.Script{Hijack: "203.0.113.66"})
+	}
+	farm, err := fakedns.StartFarm(zone, scripts...)
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	list := farm.Addrs()[1:]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	tpl := "a.test A=192.0.2.1\nnx.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	var states, outputs []string
+	for _, shard := range []string{"1/2", "2/2"} {
+		statePath := filepath.Join(dir, "shard"+shard[:1]+".state")
+		outputPath := filepath.Join(dir, "shard"+shard[:1]+".txt")
+		out, code := runCLI(t,
+			"-list", strings.Join(list, ","),
+			"-allow-special",
+			"-shard", shard,
+			"-template", tplPath,
+			"-trusted-list", farm.Servers[0].Addr,
+			"-trusted-timeout", "1",
+			"-timeout", "1",
+			"-state", statePath,
+			"-o", outputPath,
+		)
+		if code != 0 {
+			t.Fatalf("shard %s exited with code %d\n%s", shard, code, out)
+		}
+		states = append(states, statePath)
+		outputs = append(outputs, outputPath)
+	}
+	// a shard merged twice must not be counted twice
+	outPath := filepath.Join(dir, "merged.txt")
+	args := append([]string{"merge", "-o", outPath}, states...)
+	out, code := runCLI(t, append(args, states[0])...)
+	if code != 0 {
+		t.Fatalf("merge exited with code %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Valid servers: 8/16 (50.0%), merged from 3 file(s)") {
+		t.Errorf("unexpected merge summary:\n%s", out)
+	}
+	data, _ := os.ReadFile(outPath)
+	got := strings.Fields(string(data))
+	var want []string
+	for i, addr := range list {
+		if i%2 == 0 {
+			want = append(want, addr)
+		}
+	}
+	if !slices.Equal(got, want) { // sorted by address, like the farm
+		t.Errorf("merged output: got %v, want %v", got, want)
+	}
+
+	// -o files of the shards can be merged too (invalid servers unknown)
+	args = append([]string{"merge", "-o", outPath}, outputs...)
+	out, code = runCLI(t, append(args, outputs[1])...)
+	if code != 0 {
+		t.Fatalf("merge of -o files exited with code %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Valid servers: 8, merged from 3 file(s) (3 -o file(s)") {
+		t.Errorf("unexpected merge summary:\n%s", out)
+	}
+	data, _ = os.ReadFile(outPath)
+	if got := strings.Fields(string(data)); !slices.Equal(got, want) {
+		t.Errorf("merged -o files: got %v, want %v", got, want)
+	}
+}
+
+// TestIntegrationOfflineUntested checks that servers left unfinished by
+// -max-duration (in the pool, or not loaded yet) go to -o-untested file.
+func TestIntegrationOfflineUntested(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	drop := fakedns.Script{Drop: true}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{}, drop, drop, drop)
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	list := farm.Addrs()[1:]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	untestedPath := filepath.Join(dir, "untested.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	out, code := runCLI(t,
+		"-list", strings.Join(list, ","),
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-timeout", "2",
+		"-threads", "1",
+		"-max-poolsize", "1",
+		"-max-duration", "500ms",
+		"-o", filepath.Join(dir, "out.txt"),
+		"-o-untested", untestedPath,
+	)
+	if code != 0 {
+		t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+	}
+	data, _ := os.ReadFile(untestedPath)
+	got := strings.Fields(string(data))
+	slices.Sort(got)
+	want := slices.Clone(list)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("-o-untested file: got %v, want %v\n%s", got, want, out)
+	}
+}
+
+// TestIntegrationOfflineScore checks that -sort score writes slow
+// servers last, and that -min-score drops them.
+func TestIntegrationOfflineScore(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{},
+		fakedns.Script{Delay: 300 * time.Millisecond}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	trusted, slow, fast := farm.Servers[0], farm.Servers[1], farm.Servers[2]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	tpl := "a.test A=192.0.2.1 weight=2\nnx.test NXDOMAIN\n"
+	if err := os.WriteFile(tplPath, []byte(tpl), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	run := func(extra ...string) ([]string, string) {
+		t.Helper()
+		out, code := runCLI(t, append([]string{
+			"-list", slow.Addr + "," + fast.Addr,
+			"-allow-special",
+			"-template", tplPath,
+			"-trusted-list", trusted.Addr,
+			"-trusted-timeout", "1",
+			"-timeout", "1",
+			"-o", outPath,
+			"-sort", "score",
+		}, extra...)...)
+		if code != 0 {
+			t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+		}
+		data, _ := os.ReadFile(outPath)
+		return strings.Fields(string(data)), out
+	}
+
+	if got, _ := run(); !slices.Equal(got, []string{fast.Addr, slow.Addr}) {
+		t.Errorf("-sort score: got %v, want fast server first", got)
+	}
+	got, out := run("-min-score", "95", "-verbose")
+	if !slices.Equal(got, []string{fast.Addr}) {
+		t.Errorf("-min-score 95: got %v, want only fast server", got)
+	}
+	// (servers dropped by -min-score passed all checks)
+	if want := "[-] SERVER " + slow.Addr + " (invalid, score too low)"; !strings.Contains(out, want) {
+		t.Errorf("-verbose: expected %q, got:\n%s", want, out)
+	}
+}
+
+// TestIntegrationOfflineTrustedFailure checks that dnsanity refuses to run
+// when TRUSTED servers don't validate the template.
+func TestIntegrationOfflineTrustedFailure(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone,
+		fakedns.Script{Hijack: "203.0.113.66"}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	out, code := runCLI(
+		t,
+		"-list", farm.Servers[1].Addr,
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-o", filepath.Join(dir, "out.txt"),
+	)
+	if code == 0 {
+		t.Fatalf("expected failure with a hijacking TRUSTED server\n%s", out)
+	}
+}
+
+// TestIntegrationOfflineTrustedInterrupted checks that SIGINT during the
+// template validation step stops dnsanity with exit code 130.
+func TestIntegrationOfflineTrustedInterrupted(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone, fakedns.Script{Drop: true})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(binaryPath,
+		"-list", "192.0.2.1",
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-trusted-max-attempts", "10",
+		"-o", filepath.Join(dir, "out.txt"),
+	)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting command: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	_ = cmd.Process.Signal(os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatalf("dnsanity ignored SIGINT during template validation\n%s", out.String())
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 130 {
+		t.Fatalf("expected exit code 130, got %d\n%s", code, out.String())
+	}
+}
+
+// TestIntegrationOfflineResumeAfterCrash simulates a run killed between
+// the -o line and the -state line of a server, and checks that -resume
+// doesn't test it again (nor duplicate it in -o file).
+func TestIntegrationOfflineResumeAfterCrash(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone,
+		fakedns.Script{}, fakedns.Script{}, fakedns.Script{}, fakedns.Script{})
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	list := farm.Addrs()[1:]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	statePath := filepath.Join(dir, "run.state")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	// list[0] was fully recorded, list[1] only reached -o file
+	os.WriteFile(outPath, []byte(list[0]+"\n"+list[1]+"\n"), 0644)
+	os.WriteFile(statePath, []byte(list[0]+" valid 0\n"), 0644)
+
+	out, code := runCLI(t,
+		"-list", strings.Join(list, ","),
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-timeout", "1",
+		"-o", outPath,
+		"-state", statePath,
+		"-resume",
+	)
+	if code != 0 {
+		t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "Valid servers: 3/3") {
+		t.Errorf("expected 3/3 valid servers, got:\n%s", out)
+	}
+	data, _ := os.ReadFile(outPath)
+	if got := strings.Fields(string(data)); !slices.Equal(got, list) {
+		t.Errorf("-o file: got %v, want %v", got, list)
+	}
+}
+
+// TestIntegrationOfflineWatch runs 2 -watch cycles, and checks that the
+// healthy servers stay in -o file while the failing one waits for its
+// backoff (retested on cycle 3 only).
+func TestIntegrationOfflineWatch(t *testing.T) {
+	zone := fakedns.Zone{"a.test": {A: []string{"192.0.2.1"}}}
+	farm, err := fakedns.StartFarm(zone,
+		fakedns.Script{}, // trusted
+		fakedns.Script{},
+		fakedns.Script{},
+		fakedns.Script{Hijack: "203.0.113.66"},
+	)
+	if err != nil {
+		t.Fatalf("Cannot start servers: %v", err)
+	}
+	defer farm.Close()
+	list := farm.Addrs()[1:]
+
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "template.txt")
+	outPath := filepath.Join(dir, "healthy.txt")
+	if err := os.WriteFile(tplPath, []byte("a.test A=192.0.2.1\n"), 0644); err != nil {
+		t.Fatalf("Cannot write template file: %v", err)
+	}
+	out, code := runCLI(t,
+		"-list", strings.Join(list, ","),
+		"-allow-special",
+		"-template", tplPath,
+		"-trusted-list", farm.Servers[0].Addr,
+		"-trusted-timeout", "1",
+		"-timeout", "1",
+		"-watch", "1s",
+		"-max-duration", "1700ms", // cycles start at 0s and 1s
+		"-o", outPath,
+	)
+	if code != 0 {
+		t.Fatalf("dnsanity exited with code %d\n%s", code, out)
+	}
+	if !strings.Contains(out, "cycle 2: 2 healthy servers (+0, -0), 1 failing") {
+		t.Errorf("unexpected cycle 2 summary:\n%s", out)
+	}
+	data, _ := os.ReadFile(outPath)
+	got := strings.Fields(string(data))
+	slices.Sort(got)
+	want := slices.Clone(list[:2])
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("-o file after cycle 2: got %v, want %v\n%s", got, want, out)
+	}
+	for i, wantQueries := range []int{2, 2, 1} {
+		if n := farm.Servers[i+1].Queries(); n != wantQueries {
+			t.Errorf("server %s: got %d queries, want %d", list[i], n, wantQueries)
+		}
+	}
+}
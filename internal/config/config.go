@@ -2,21 +2,38 @@ package config
 
 import (
 	// standard
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	// external
 	// local
 	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/netutil"
 	"github.com/nil0x42/dnsanity/internal/tty"
 )
 
 type Config struct {
-	Opts             *Options
-	TrustedDNSList   []string
-	UntrustedDNSList []string
-	Template         dns.Template
-	OutputFile       *os.File
+	Opts           *Options
+	TrustedDNSList []string
+	UntrustedDNS   *ServerSource // read lazily by the server pool
+	ListOptions    SourceOptions // to re-open -list (-watch)
+	Template       dns.Template
+	PrunedEntries  []*dns.EntryVotes // removed by -prune-template
+	Differential   bool              // Template answers are learned from trusted servers
+	ASNDB          *netutil.ASNDB
+	DeadServers    int          // servers found dead by -prefilter
+	Unprobed       int          // servers left unprobed by -prefilter (interrupted)
+	RetryOn        []string     // -retry-on statuses
+	FastFail       []string     // -fast-fail statuses
+	OutputFile     *os.File     // nil with -watch (rewritten atomically)
+	StateFile      *os.File     // -state file (nil if unset)
+	JSONFile       *os.File     // -oJ file (nil if unset)
+	InvalidFile    *os.File     // -o-invalid file (nil if unset)
+	TimeoutFile    *os.File     // -o-timeout file (nil if unset)
+	UntestedFile   *os.File     // -o-untested file (nil if unset)
+	ResumeState    *ResumeState // servers done by previous run (-resume)
 }
 
 func exitUsage(format string, a ...interface{}) {
@@ -35,14 +52,61 @@ func Init() *Config {
 
 	// TEMPLATE VALIDATION --------------------------------------------
 	// -template
-	if opts.Template == "" {
+	if len(opts.Templates) == 0 {
 		conf.Template, err = dns.NewTemplate(DEFAULT_TEMPLATE)
 	} else {
-		conf.Template, err = dns.NewTemplateFromFile(opts.Template)
+		conf.Template, err = dns.NewTemplateFromFiles(opts.Templates...)
 	}
 	if err != nil {
 		exitUsage("-template: %w", err)
 	}
+	// -template-tags
+	if opts.TemplateTags != "" {
+		tags := parseTagList(opts.TemplateTags)
+		conf.Template = conf.Template.FilterTags(tags)
+		if len(conf.Template) == 0 {
+			exitUsage("-template-tags: no template entry matches %q", opts.TemplateTags)
+		}
+	}
+	// -asn-db
+	if opts.ASNDBPath != "" {
+		conf.ASNDB, err = netutil.LoadASNDB(opts.ASNDBPath)
+		if err != nil {
+			exitUsage("-asn-db: %w", err)
+		}
+	}
+	// -diff-list
+	if opts.DiffList != "" {
+		if len(opts.Templates) > 0 || opts.TemplateTags != "" {
+			exitUsage("-diff-list: can't be combined with -template or -template-tags")
+		}
+		domains, err := ParseDomainList(opts.DiffList)
+		if err != nil {
+			exitUsage("-diff-list: %w", err)
+		}
+		var eq dns.Equivalence
+		switch opts.DiffMatch {
+		case "exact":
+			eq = dns.ExactEquivalence
+		case "prefix":
+			if opts.DiffPrefix < 0 || opts.DiffPrefix > 32 {
+				exitUsage("-diff-prefix: must be between 0 and 32")
+			}
+			if opts.DiffPrefix6 < 0 || opts.DiffPrefix6 > 128 {
+				exitUsage("-diff-prefix6: must be between 0 and 128")
+			}
+			eq = dns.PrefixEquivalence(opts.DiffPrefix, opts.DiffPrefix6)
+		case "asn":
+			if conf.ASNDB == nil {
+				exitUsage("-diff-match: 'asn' requires -asn-db")
+			}
+			eq = dns.ASNEquivalence(conf.ASNDB)
+		default:
+			exitUsage("-diff-match: must be 'exact', 'prefix' or 'asn'")
+		}
+		conf.Template = dns.NewDifferentialTemplate(domains, eq)
+		conf.Differential = true
+	}
 	// -trusted-list
 	conf.TrustedDNSList, err = ParseServerList(opts.TrustedDNS)
 	if err != nil {
@@ -60,6 +124,20 @@ func Init() *Config {
 	if opts.TrustedAttempts < 1 {
 		exitUsage("-trusted-max-attempts: must be >= 1")
 	}
+	// -trusted-quorum
+	numTrusted := NumDistinctServers(conf.TrustedDNSList)
+	if opts.TrustedQuorum < 0 || opts.TrustedQuorum > numTrusted {
+		exitUsage("-trusted-quorum: must be between 0 and %d (trusted servers)",
+			numTrusted)
+	}
+	// -prune-template
+	if opts.PruneTemplate && conf.Differential {
+		exitUsage("-prune-template: can't be combined with -diff-list")
+	}
+	// -min-template-entries
+	if opts.MinTplEntries < 1 {
+		exitUsage("-min-template-entries: must be >= 1")
+	}
 
 	// SERVERS SANITIZATION -------------------------------------------
 	// -list
@@ -74,10 +152,52 @@ func Init() *Config {
 			}
 		}
 	}
-	conf.UntrustedDNSList, err = ParseServerList(opts.UntrustedDNS)
+	// -max-range-size
+	if opts.MaxRangeSize < 1 {
+		exitUsage("-max-range-size: must be >= 1")
+	}
+	srcOpts := SourceOptions{
+		MaxRangeSize: uint64(opts.MaxRangeSize),
+		SkipNetBcast: opts.SkipNetBcast,
+		AllowSpecial: opts.AllowSpecial,
+	}
+	// -exclude
+	if opts.Exclude != "" {
+		srcOpts.Exclude, err = ParseExcludeList(opts.Exclude)
+		if err != nil {
+			exitUsage("-exclude: %w", err)
+		}
+	}
+	// -shard
+	if opts.Shard != "" {
+		if srcOpts.Shard, err = ParseShard(opts.Shard); err != nil {
+			exitUsage("-shard: %w", err)
+		}
+	}
+	// -resume (finished servers are skipped while reading -list)
+	if opts.Resume {
+		if opts.StateFilePath == "" {
+			exitUsage("-resume: requires -state")
+		}
+		conf.ResumeState, err = LoadState(opts.StateFilePath)
+		if errors.Is(err, os.ErrNotExist) {
+			conf.ResumeState = &ResumeState{Servers: map[string]StateEntry{}}
+		} else if err != nil {
+			exitUsage("-state: %w", err)
+		}
+		// (servers written to -o file are done, even if missing from -state)
+		if st, err := os.Stat(opts.OutputFilePath); err == nil && st.Mode().IsRegular() {
+			if err := conf.ResumeState.LoadOutput(opts.OutputFilePath); err != nil {
+				exitUsage("-o: %w", err)
+			}
+		}
+		srcOpts.Skip = conf.ResumeState.Done
+	}
+	conf.UntrustedDNS, err = OpenServerSource(opts.UntrustedDNS, srcOpts)
 	if err != nil {
 		exitUsage("-list: %w", err)
 	}
+	conf.ListOptions = srcOpts
 	// -timeout
 	if opts.Timeout < 1 {
 		exitUsage("-timeout: must be >= 1")
@@ -86,20 +206,147 @@ func Init() *Config {
 	if opts.RateLimit < 0 {
 		exitUsage("-ratelimit: must be >= 0")
 	}
+	// -adaptive-ratelimit
+	if opts.AdaptiveRate {
+		if opts.MinRateLimit <= 0 {
+			exitUsage("-min-ratelimit: must be > 0")
+		}
+		if opts.MaxRateLimit < opts.MinRateLimit {
+			exitUsage("-max-ratelimit: must be >= -min-ratelimit")
+		}
+	}
+	// -net-ratelimit
+	if opts.NetRateLimit < 0 {
+		exitUsage("-net-ratelimit: must be >= 0")
+	}
+	if opts.NetPrefix4 < 0 || opts.NetPrefix4 > 32 {
+		exitUsage("-net-prefix4: must be between 0 and 32")
+	}
+	if opts.NetPrefix6 < 0 || opts.NetPrefix6 > 128 {
+		exitUsage("-net-prefix6: must be between 0 and 128")
+	}
+	// -asn-ratelimit
+	if opts.ASNRateLimit < 0 {
+		exitUsage("-asn-ratelimit: must be >= 0")
+	} else if opts.ASNRateLimit > 0 && conf.ASNDB == nil {
+		exitUsage("-asn-ratelimit: requires -asn-db")
+	}
 	// -max-attempts
 	if opts.Attempts < 1 {
 		exitUsage("-max-attempts: must be >= 1")
 	}
+	// -retry-on
+	if conf.RetryOn, err = parseStatusList(opts.RetryOn); err != nil {
+		exitUsage("-retry-on: %w", err)
+	}
+	// -retry-backoff
+	if opts.RetryBackoff < 0 {
+		exitUsage("-retry-backoff: must be >= 0")
+	}
+	// -fast-fail
+	if conf.FastFail, err = parseStatusList(opts.FastFail); err != nil {
+		exitUsage("-fast-fail: %w", err)
+	}
 	// -max-mismatches
 	if opts.MaxMismatches < 0 {
 		exitUsage("-max-mismatches: must be >= 0")
 	}
+	// -min-score
+	if opts.MinScore < 0 || opts.MinScore > 100 {
+		exitUsage("-min-score: must be between 0 and 100")
+	}
+	// -check-order
+	if opts.CheckOrder != "template" && opts.CheckOrder != "failures" {
+		exitUsage("-check-order: must be 'template' or 'failures'")
+	}
+	// -prefilter-timeout
+	if opts.PrefilterTimeout < 1 {
+		exitUsage("-prefilter-timeout: must be >= 1")
+	}
 
 	// GENERIC OPTIONS ------------------------------------------------
+	// -watch
+	if opts.Watch < 0 {
+		exitUsage("-watch: must be >= 0")
+	} else if opts.Watch > 0 {
+		if _, known := conf.UntrustedDNS.Total(); !known {
+			exitUsage("-watch: -list must be a file or a comma separated list")
+		}
+		switch opts.OutputFilePath {
+		case "", "-", "/dev/stdout":
+			exitUsage("-watch: requires -o FILE")
+		}
+		if opts.StateFilePath != "" {
+			exitUsage("-watch: can't be combined with -state or -resume")
+		}
+		// (only -o is rewritten per cycle, others would grow forever)
+		for _, out := range []struct {
+			flag string
+			set  bool
+		}{
+			{"-oJ", opts.JSONFilePath != ""},
+			{"-o-invalid", opts.InvalidFilePath != ""},
+			{"-o-timeout", opts.TimeoutFilePath != ""},
+			{"-verbose", opts.Verbose},
+		} {
+			if out.set {
+				exitUsage("-watch: can't be combined with %s", out.flag)
+			}
+		}
+	}
+	// -sort
+	if opts.Sort != "none" && opts.Sort != "score" {
+		exitUsage("-sort: must be 'none' or 'score'")
+	} else if opts.Sort == "score" && opts.Watch > 0 {
+		exitUsage("-sort: can't be combined with -watch")
+	} else if opts.Sort == "score" && opts.StateFilePath != "" {
+		// (servers held until the end would be lost by a resumed run)
+		exitUsage("-sort: can't be combined with -state or -resume")
+	}
+	// -resume
+	openFile := OpenFile
+	if opts.Resume {
+		openFile = AppendFile
+	}
 	// -o
-	conf.OutputFile, err = OpenFile(opts.OutputFilePath)
-	if err != nil {
-		exitUsage("-o: %w", err)
+	if opts.Watch == 0 {
+		conf.OutputFile, err = openFile(opts.OutputFilePath)
+		if err != nil {
+			exitUsage("-o: %w", err)
+		}
+	}
+	// -oJ
+	if opts.JSONFilePath != "" {
+		conf.JSONFile, err = openFile(opts.JSONFilePath)
+		if err != nil {
+			exitUsage("-oJ: %w", err)
+		}
+	}
+	// -o-invalid, -o-timeout, -o-untested
+	for _, out := range []struct {
+		flag, path string
+		file       **os.File
+	}{
+		{"-o-invalid", opts.InvalidFilePath, &conf.InvalidFile},
+		{"-o-timeout", opts.TimeoutFilePath, &conf.TimeoutFile},
+		{"-o-untested", opts.UntestedFilePath, &conf.UntestedFile},
+	} {
+		if out.path != "" {
+			if *out.file, err = openFile(out.path); err != nil {
+				exitUsage("%s: %w", out.flag, err)
+			}
+		}
+	}
+	// -state
+	if opts.StateFilePath != "" {
+		conf.StateFile, err = openFile(opts.StateFilePath)
+		if err != nil {
+			exitUsage("-state: %w", err)
+		}
+	}
+	// -max-duration
+	if opts.MaxDuration < 0 {
+		exitUsage("-max-duration: must be >= 0")
 	}
 	// -global-ratelimit
 	if opts.GlobRateLimit < 1 {
@@ -122,9 +369,48 @@ func Init() *Config {
 	return conf
 }
 
+// parseTagList splits a comma separated list of template tags.
+func parseTagList(input string) []string {
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseStatusList splits a comma separated list of answer statuses
+// (e.g. "TIMEOUT,ECONNREFUSED"), as uppercase. An empty list isn't nil.
+// Statuses must be known by the resolver, or "TC" (truncated answer).
+func parseStatusList(input string) ([]string, error) {
+	statuses := []string{}
+	for _, status := range strings.Split(input, ",") {
+		status = strings.ToUpper(strings.TrimSpace(status))
+		if status == "" {
+			continue
+		}
+		if status != "TC" && !dns.IsKnownStatus(status) {
+			return nil, fmt.Errorf(
+				"Invalid status: %q (want an rcode, TIMEOUT, TC or an errno name)", status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
 func OpenFile(path string) (*os.File, error) {
+	return openFileFlag(path, os.O_TRUNC)
+}
+
+// AppendFile is like OpenFile(), but keeps existing content.
+func AppendFile(path string) (*os.File, error) {
+	return openFileFlag(path, os.O_APPEND)
+}
+
+func openFileFlag(path string, flag int) (*os.File, error) {
 	if path == "" || path == "-" || path == "/dev/stdout" {
 		return os.Stdout, nil
 	}
-	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, 0644)
 }
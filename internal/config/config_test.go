@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/nil0x42/dnsanity/internal/config"
@@ -32,6 +33,15 @@ func helperResetFlags(args []string) {
 	flag.CommandLine = flag.NewFlagSet(args[0], flag.ExitOnError)
 }
 
+// readSource returns every server of a ServerSource.
+func readSource(ss *config.ServerSource) []string {
+	var ips []string
+	for ip, ok := ss.Next(); ok; ip, ok = ss.Next() {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
 // ---------------------------------------------------------------------------
 // OpenFile() unit‑tests
 // ---------------------------------------------------------------------------
@@ -84,8 +94,8 @@ func TestInitSuccessBasic(t *testing.T) {
 		"-o", outFile,
 	})
 	conf := config.Init()
-	if len(conf.UntrustedDNSList) != 1 || conf.UntrustedDNSList[0] != "8.8.8.8" {
-		t.Fatalf("unexpected UntrustedDNSList: %+v", conf.UntrustedDNSList)
+	if got := readSource(conf.UntrustedDNS); len(got) != 1 || got[0] != "8.8.8.8" {
+		t.Fatalf("unexpected UntrustedDNS: %+v", got)
 	}
 	if conf.OutputFile == os.Stdout {
 		t.Fatalf("OutputFile should be custom, got Stdout")
@@ -115,6 +125,99 @@ func TestInitWithExternalTemplate(t *testing.T) {
 	}
 }
 
+func TestInitWithMultipleTemplatesAndTags(t *testing.T) {
+	dir := t.TempDir()
+	tplA := filepath.Join(dir, "a.tpl")
+	tplB := filepath.Join(dir, "b.tpl")
+	os.WriteFile(tplA, []byte("a.com A=1.2.3.4 [cdn]\nb.com NXDOMAIN [nx]\n"), 0644)
+	os.WriteFile(tplB, []byte("c.com NXDOMAIN [nx,censorship]\nd.com NOERROR\n"), 0644)
+
+	helperResetFlags([]string{
+		"dnsanity",
+		"-list", "1.1.1.1",
+		"-template", tplA,
+		"-template", tplB,
+		"-template-tags", "nx, censorship",
+	})
+	conf := config.Init()
+	if len(conf.Template) != 2 ||
+		conf.Template[0].Domain != "b.com" || conf.Template[1].Domain != "c.com" {
+		t.Fatalf("unexpected filtered template: %+v", conf.Template)
+	}
+}
+
+func TestInitDifferentialMode(t *testing.T) {
+	helperResetFlags([]string{
+		"dnsanity",
+		"-list", "1.1.1.1",
+		"-diff-list", "www.google.com, www.example.com",
+		"-diff-match", "exact",
+	})
+	conf := config.Init()
+	if !conf.Differential || len(conf.Template) != 2 {
+		t.Fatalf("differential template not built: %+v", conf.Template)
+	}
+	if conf.Template[0].Equivalent == nil || len(conf.Template[0].ValidAnswers) != 0 {
+		t.Fatalf("differential entries must start without answers: %+v", conf.Template[0])
+	}
+}
+
+func TestInitRetryPolicy(t *testing.T) {
+	helperResetFlags([]string{
+		"dnsanity",
+		"-list", "1.1.1.1",
+		"-retry-on", "timeout, tc",
+		"-fast-fail", "ECONNREFUSED,EHOSTUNREACH",
+	})
+	conf := config.Init()
+	if !reflect.DeepEqual(conf.RetryOn, []string{"TIMEOUT", "TC"}) {
+		t.Errorf("unexpected RetryOn: %v", conf.RetryOn)
+	}
+	if !reflect.DeepEqual(conf.FastFail, []string{"ECONNREFUSED", "EHOSTUNREACH"}) {
+		t.Errorf("unexpected FastFail: %v", conf.FastFail)
+	}
+
+	// empty -retry-on disables retries (not the default statuses)
+	helperResetFlags([]string{"dnsanity", "-list", "1.1.1.1", "-retry-on", ""})
+	conf = config.Init()
+	if conf.RetryOn == nil || len(conf.RetryOn) != 0 {
+		t.Errorf("expected empty non-nil RetryOn, got %#v", conf.RetryOn)
+	}
+}
+
+func TestInitResume(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.txt")
+	outFile := filepath.Join(dir, "out.txt")
+	os.WriteFile(stateFile, []byte("1.1.1.1 valid 0\n8.8.8.8 invalid 1\n"), 0644)
+	os.WriteFile(outFile, []byte("1.1.1.1\n"), 0644)
+
+	helperResetFlags([]string{
+		"dnsanity",
+		"-list", "1.1.1.1, 8.8.8.8, 9.9.9.9",
+		"-o", outFile,
+		"-state", stateFile,
+		"-resume",
+	})
+	conf := config.Init()
+	if got := readSource(conf.UntrustedDNS); len(got) != 1 || got[0] != "9.9.9.9" {
+		t.Fatalf("finished servers not skipped: %+v", got)
+	}
+	if len(conf.ResumeState.Servers) != 2 {
+		t.Fatalf("unexpected resume state: %+v", conf.ResumeState)
+	}
+	// output & state files are appended to, not truncated
+	io.WriteString(conf.OutputFile, "9.9.9.9\n")
+	conf.OutputFile.Close()
+	conf.StateFile.Close()
+	if data, _ := os.ReadFile(outFile); string(data) != "1.1.1.1\n9.9.9.9\n" {
+		t.Fatalf("output file was truncated: %q", data)
+	}
+	if data, _ := os.ReadFile(stateFile); len(data) == 0 {
+		t.Fatal("state file was truncated")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // exitUsage() branches – covered via helper process
 // ---------------------------------------------------------------------------
@@ -132,10 +235,262 @@ func TestExitUsageScenarios(t *testing.T) {
 				"-list", "8.8.8.8",
 			},
 		},
+		{
+			name: "trusted_quorum_too_high",
+			args: []string{
+				"-trusted-list", "8.8.8.8,1.1.1.1",
+				"-trusted-quorum", "3",
+				"-list", "8.8.8.8",
+			},
+		},
+		{
+			name: "trusted_quorum_above_distinct_servers",
+			args: []string{
+				"-trusted-list", "8.8.8.8,1.1.1.1,8.8.8.8",
+				"-trusted-quorum", "3",
+				"-list", "8.8.8.8",
+			},
+		},
+		{
+			name: "min_score_too_high",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-min-score", "101",
+			},
+		},
+		{
+			name: "invalid_sort",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-sort", "ip",
+			},
+		},
+		{
+			name: "sort_score_with_watch",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-sort", "score",
+				"-watch", "1h",
+				"-o", filepath.Join(tmpDir, "out.txt"),
+			},
+		},
+		{
+			name: "sort_score_with_state",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-sort", "score",
+				"-state", filepath.Join(tmpDir, "state.txt"),
+			},
+		},
+		{
+			name: "invalid_shard",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-shard", "3/2",
+			},
+		},
+		{
+			name: "prune_template_with_diff_list",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-diff-list", "example.com",
+				"-prune-template",
+			},
+		},
+		{
+			name: "invalid_min_template_entries",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-min-template-entries", "0",
+			},
+		},
+		{
+			name: "invalid_retry_on",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-retry-on", "TIME-OUT",
+			},
+		},
+		{
+			name: "unknown_retry_on",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-retry-on", "TIMEOUT,SRVFAIL",
+			},
+		},
+		{
+			name: "unknown_fast_fail",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-fast-fail", "ECONNREFUSE",
+			},
+		},
+		{
+			name: "negative_retry_backoff",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-retry-backoff", "-1s",
+			},
+		},
 		{
 			name: "missing_list_stdin",
 			args: []string{}, // No -list flag triggers /dev/stdin branch then failure
 		},
+		{
+			name: "template_tags_no_match",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-template-tags", "no-such-tag",
+			},
+		},
+		{
+			name: "diff_list_with_template",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-diff-list", "example.com",
+				"-template-tags", "nx",
+			},
+		},
+		{
+			name: "asn_ratelimit_without_db",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-asn-ratelimit", "5",
+			},
+		},
+		{
+			name: "invalid_net_prefix4",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-net-ratelimit", "5", "-net-prefix4", "33",
+			},
+		},
+		{
+			name: "negative_max_duration",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-max-duration", "-1s",
+			},
+		},
+		{
+			name: "range_too_large",
+			args: []string{
+				"-list", "10.0.0.0/16",
+				"-max-range-size", "256",
+			},
+		},
+		{
+			name: "invalid_exclude",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-exclude", "8.8.8.0/33",
+			},
+		},
+		{
+			name: "all_servers_filtered",
+			args: []string{
+				"-list", "10.0.0.1, 8.8.8.8",
+				"-exclude", "8.8.8.8",
+			},
+		},
+		{
+			name: "negative_watch",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "-1m",
+			},
+		},
+		{
+			name: "watch_without_output_file",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h",
+			},
+		},
+		{
+			name: "watch_with_state",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h", "-o", "/tmp/dnsanity-watch.txt",
+				"-state", "/tmp/dnsanity-watch.state",
+			},
+		},
+		{
+			name: "watch_with_json",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h", "-o", "/tmp/dnsanity-watch.txt",
+				"-oJ", "/tmp/dnsanity-watch.jsonl",
+			},
+		},
+		{
+			name: "watch_with_invalid",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h", "-o", "/tmp/dnsanity-watch.txt",
+				"-o-invalid", "/tmp/dnsanity-watch.invalid",
+			},
+		},
+		{
+			name: "watch_with_timeout",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h", "-o", "/tmp/dnsanity-watch.txt",
+				"-o-timeout", "/tmp/dnsanity-watch.timeout",
+			},
+		},
+		{
+			name: "watch_with_verbose",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-watch", "1h", "-o", "/tmp/dnsanity-watch.txt",
+				"-verbose",
+			},
+		},
+		{
+			name: "resume_without_state",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-resume",
+			},
+		},
+		{
+			name: "invalid_check_order",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-check-order", "random",
+			},
+		},
+		{
+			name: "adaptive_min_ratelimit_zero",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-adaptive-ratelimit", "-min-ratelimit", "0",
+			},
+		},
+		{
+			name: "adaptive_max_below_min",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-adaptive-ratelimit", "-min-ratelimit", "5", "-max-ratelimit", "2",
+			},
+		},
+		{
+			name: "diff_match_asn_without_db",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-diff-list", "example.com",
+				"-diff-match", "asn",
+			},
+		},
+		{
+			name: "diff_match_invalid",
+			args: []string{
+				"-list", "8.8.8.8",
+				"-diff-list", "example.com",
+				"-diff-match", "fuzzy",
+			},
+		},
 		{
 			name: "bad_output_path",
 			args: []string{
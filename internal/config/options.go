@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// external
 	// local
@@ -13,25 +15,74 @@ import (
 
 type Options struct {
 	UntrustedDNS     string
+	MaxRangeSize     int
+	SkipNetBcast     bool
+	Exclude          string
+	AllowSpecial     bool
+	Shard            string
 	TrustedDNS       string
-	Template         string
+	Templates        stringList
+	TemplateTags     string
+	DiffList         string
+	DiffMatch        string
+	DiffPrefix       int
+	DiffPrefix6      int
+	ASNDBPath        string
 	Threads          int
 	MaxPoolSize      int
 	Timeout          int
 	TrustedTimeout   int
 	GlobRateLimit    int
 	RateLimit        float64
+	AdaptiveRate     bool
+	MinRateLimit     float64
+	MaxRateLimit     float64
+	NetRateLimit     float64
+	NetPrefix4       int
+	NetPrefix6       int
+	ASNRateLimit     float64
 	TrustedRateLimit float64
 	Attempts         int
 	MaxMismatches    int
+	RetryOn          string
+	RetryBackoff     time.Duration
+	FastFail         string
+	CheckOrder       string
+	MinScore         float64
+	Sort             string
+	Prefilter        bool
+	PrefilterTimeout int
 	TrustedAttempts  int
+	TrustedQuorum    int
+	PruneTemplate    bool
+	MinTplEntries    int
 	OutputFilePath   string
+	JSONFilePath     string
+	InvalidFilePath  string
+	TimeoutFilePath  string
+	UntestedFilePath string
+	StateFilePath    string
+	Resume           bool
+	MaxDuration      time.Duration
+	Watch            time.Duration
 	ShowHelp         bool
 	ShowVersion      bool
 	Verbose          bool
 	Debug            bool
 }
 
+// stringList is a flag.Value collecting every occurrence of a flag.
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
 func ShowHelp() {
 	var rst = "\033[0m"
 	var bol = "\033[1m"
@@ -60,12 +111,50 @@ func ShowHelp() {
 		whi, rst, yel, rst, yel, rst)
 	s += fmt.Sprintf("\n")
 
+	s += fmt.Sprintf(
+		"%sSUBCOMMANDS:%s\n",
+		bol, rst)
+	s += fmt.Sprintf(
+		"   %stemplate lint%s %s[FILE]...%s    report suspicious template entries (exits non-zero if any)\n",
+		whi, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %smerge%s %sFILE...%s              merge %s-state%s or %s-o%s files of %s-shard%s runs: write valid servers, and summary\n",
+		whi, rst, gra, rst, yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf("\n")
+
 	s += fmt.Sprintf(
 		"%sGENERIC OPTIONS:%s\n",
 		bol, rst)
 	s += fmt.Sprintf(
 		"   %s-o%s %s[FILE]%s                  file to write output (defaults to %sSTDOUT%s)\n",
 		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-oJ%s %s[FILE]%s                 file to write full per-server results as JSON Lines (verdict, checks, timing)\n",
+		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-o-invalid%s %s[FILE]%s          file to write invalid servers, with their first failed check\n",
+		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-o-timeout%s %s[FILE]%s          file to write servers which only failed without answering (instead of %s-o-invalid%s)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-o-untested%s %s[FILE]%s         file to write servers left untested by an interruption\n",
+		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-sort%s %s[str]%s                order of %s-o%s servers: %snone%s (as they finish), or %sscore%s (best first, written at the end) (default %snone%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-state%s %s[FILE]%s              periodically save finished servers & verdicts (checkpoint)\n",
+		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-resume%s                     skip servers already in %s-state%s file, and append to %s-o%s file\n",
+		yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-max-duration%s %sduration%s     stop sanitization after this time, e.g. %s2h30m%s (default %s0%s: unlimited)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-watch%s %sduration%s            keep running, re-sanitizing %s-list%s at this interval, e.g. %s1h%s (default %s0%s: off)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-global-ratelimit%s %sint%s      global max requests per second (default %s500%s)\n",
 		yel, rst, gra, rst, yel, rst)
@@ -81,28 +170,88 @@ func ShowHelp() {
 		"%sSERVERS SANITIZATION:%s\n",
 		bol, rst)
 	s += fmt.Sprintf(
-		"   %s-list%s %s[FILE||str]%s          list of DNS servers to sanitize (%sfile%s or %scomma separated%s or %sSTDIN%s)\n",
+		"   %s-list%s %s[FILE||str]%s          list of DNS servers, CIDRs or IP ranges to sanitize (%sfile%s or %scomma separated%s or %sSTDIN%s)\n",
 		yel, rst, gra, rst, yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-max-range-size%s %sint%s        max addresses per CIDR or IP range in %s-list%s (default %s65536%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-skip-net-bcast%s            skip network & broadcast addresses of IPv4 CIDRs in %s-list%s\n",
+		yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-exclude%s %s[FILE||str]%s       IPs, CIDRs or IP ranges to remove from %s-list%s\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-allow-special%s             keep special-purpose addresses (private, loopback, multicast...) in %s-list%s\n",
+		yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-shard%s %si/n%s                 only sanitize the i-th of n disjoint, hash-based subsets of %s-list%s\n",
+		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-timeout%s %sint%s               timeout in seconds for DNS queries (default %s4%s)\n",
 		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-ratelimit%s %sfloat%s           max requests per second per DNS server (default %s2%s)\n",
 		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-adaptive-ratelimit%s        adapt each server's ratelimit to its REFUSED/TIMEOUT answers (starts at %s-ratelimit%s)\n",
+		yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-min-ratelimit%s %sfloat%s       lowest adaptive ratelimit per DNS server (default %s0.5%s)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-max-ratelimit%s %sfloat%s       highest adaptive ratelimit per DNS server (default %s20%s)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-net-ratelimit%s %sfloat%s       max requests per second per network (default %s0%s: unlimited)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-net-prefix4%s %sint%s           IPv4 prefix length of a network for %s-net-ratelimit%s (default %s24%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-net-prefix6%s %sint%s           IPv6 prefix length of a network for %s-net-ratelimit%s (default %s48%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-asn-ratelimit%s %sfloat%s       max requests per second per AS, needs %s-asn-db%s (default %s0%s: unlimited)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-max-attempts%s %sint%s          max attempts before marking a mismatching DNS test as failed (default %s2%s)\n",
 		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-retry-on%s %s[str]%s            statuses worth retrying a DNS test, %scomma separated%s, TC: truncated (default %sTIMEOUT,SERVFAIL,TC%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-retry-backoff%s %sduration%s    delay before a retry (pausing the server), doubled on each attempt, with jitter, e.g. 500ms (default %s0%s: none)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-fast-fail%s %s[str]%s           statuses dropping a server at once, e.g. %sECONNREFUSED%s (default: none)\n",
+		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-max-mismatches%s %sint%s        max allowed mismatching DNS tests per server (default %s0%s)\n",
 		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-min-score%s %sfloat%s           drop valid servers with a reliability score below this, from 0 to 100 (default %s0%s)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-check-order%s %s[str]%s         order of DNS tests: %stemplate%s, or %sfailures%s (most failing first) (default %stemplate%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-prefilter%s                 probe each server once first, and only test responsive ones\n",
+		yel, rst)
+	s += fmt.Sprintf(
+		"   %s-prefilter-timeout%s %sint%s     timeout in seconds for -prefilter probes (default %s1%s)\n",
+		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf("\n")
 
 	s += fmt.Sprintf(
 		"%sTEMPLATE VALIDATION:%s\n",
 		bol, rst)
 	s += fmt.Sprintf(
-		"   %s-template%s %s[FILE]%s           use a custom validation template instead of default one\n",
+		"   %s-template%s %s[FILE]%s           use a custom validation template instead of default one (repeatable)\n",
 		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-template-tags%s %s[str]%s       only run template entries with one of these %scomma separated%s tags\n",
+		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf(
 		"   %s-trusted-list%s %s[FILE||str]%s  list of TRUSTED servers (defaults to %s\"8.8.8.8, 1.1.1.1, 9.9.9.9\"%s)\n",
 		yel, rst, gra, rst, yel, rst)
@@ -115,6 +264,35 @@ func ShowHelp() {
 	s += fmt.Sprintf(
 		"   %s-trusted-max-attempts%s %sint%s  max attempts before marking a mismatching TRUSTED test as failed (default %s2%s)\n",
 		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-trusted-quorum%s %sint%s        min TRUSTED servers which must validate each template entry (default %s0%s: all)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-prune-template%s            remove template entries failing TRUSTED validation instead of aborting (exit code %s4%s)\n",
+		yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-min-template-entries%s %sint%s  min template entries left by -prune-template, else abort (default %s1%s)\n",
+		yel, rst, gra, rst, yel, rst)
+	s += fmt.Sprintf("\n")
+
+	s += fmt.Sprintf(
+		"%sDIFFERENTIAL MODE:%s\n",
+		bol, rst)
+	s += fmt.Sprintf(
+		"   %s-diff-list%s %s[FILE||str]%s     compare answers with TRUSTED servers for these domains (replaces template)\n",
+		yel, rst, gra, rst)
+	s += fmt.Sprintf(
+		"   %s-diff-match%s %s[str]%s          how A records are compared: %sexact%s, %sprefix%s or %sasn%s (default %sprefix%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-diff-prefix%s %sint%s           IPv4 prefix length for %sprefix%s matching (default %s24%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-diff-prefix6%s %sint%s          IPv6 prefix length for %sprefix%s matching (default %s48%s)\n",
+		yel, rst, gra, rst, yel, rst, yel, rst)
+	s += fmt.Sprintf(
+		"   %s-asn-db%s %s[FILE]%s             local IP to ASN database (%sCIDR ASN%s or iptoasn TSV lines)\n",
+		yel, rst, gra, rst, yel, rst)
 	s += fmt.Sprintf("\n")
 
 	s += fmt.Sprintf(
@@ -149,21 +327,59 @@ func ParseOptions() (*Options, error) {
 	opts := &Options{}
 	// GENERIC OPTIONS
 	flag.StringVar(&opts.OutputFilePath, "o", "/dev/stdout", "file to write output")
+	flag.StringVar(&opts.JSONFilePath, "oJ", "", "file to write per-server results (JSON Lines)")
+	flag.StringVar(&opts.InvalidFilePath, "o-invalid", "", "file to write invalid servers, with their first failed check")
+	flag.StringVar(&opts.TimeoutFilePath, "o-timeout", "", "file to write servers which only failed without answering")
+	flag.StringVar(&opts.UntestedFilePath, "o-untested", "", "file to write servers left untested by an interruption")
+	flag.StringVar(&opts.Sort, "sort", "none", "order of -o servers (none|score)")
+	flag.StringVar(&opts.StateFilePath, "state", "", "file to save finished servers & verdicts")
+	flag.BoolVar(&opts.Resume, "resume", false, "skip servers already in -state file")
+	flag.DurationVar(&opts.MaxDuration, "max-duration", 0, "stop sanitization after this time")
+	flag.DurationVar(&opts.Watch, "watch", 0, "re-run sanitization at this interval, keeping -o file up to date")
 	flag.IntVar(&opts.GlobRateLimit, "global-ratelimit", 500, "global rate limit")
 	flag.IntVar(&opts.Threads, "threads", -0xdead, "number of threads")
 	flag.IntVar(&opts.MaxPoolSize, "max-poolsize", -0xdead, "limit servers loaded in memory")
 	// SERVER SANITIZATION
 	flag.StringVar(&opts.UntrustedDNS, "list", "/dev/stdin", "list of DNS servers to sanitize (file or comma separated or stdin)")
+	flag.IntVar(&opts.MaxRangeSize, "max-range-size", 65536, "max addresses per CIDR or IP range in -list")
+	flag.BoolVar(&opts.SkipNetBcast, "skip-net-bcast", false, "skip network & broadcast addresses of IPv4 CIDRs in -list")
+	flag.StringVar(&opts.Exclude, "exclude", "", "IPs, CIDRs or IP ranges to remove from -list")
+	flag.BoolVar(&opts.AllowSpecial, "allow-special", false, "keep special-purpose addresses in -list")
+	flag.StringVar(&opts.Shard, "shard", "", "only sanitize shard i/n of -list (hash-based)")
 	flag.IntVar(&opts.Timeout, "timeout", 4, "timeout in seconds for DNS queries")
 	flag.Float64Var(&opts.RateLimit, "ratelimit", 2.0, "max requests per second per DNS server")
+	flag.BoolVar(&opts.AdaptiveRate, "adaptive-ratelimit", false, "adapt per-server ratelimit to REFUSED/TIMEOUT answers")
+	flag.Float64Var(&opts.MinRateLimit, "min-ratelimit", 0.5, "lowest adaptive ratelimit per DNS server")
+	flag.Float64Var(&opts.MaxRateLimit, "max-ratelimit", 20.0, "highest adaptive ratelimit per DNS server")
+	flag.Float64Var(&opts.NetRateLimit, "net-ratelimit", 0, "max requests per second per network")
+	flag.IntVar(&opts.NetPrefix4, "net-prefix4", 24, "IPv4 prefix length of a network for -net-ratelimit")
+	flag.IntVar(&opts.NetPrefix6, "net-prefix6", 48, "IPv6 prefix length of a network for -net-ratelimit")
+	flag.Float64Var(&opts.ASNRateLimit, "asn-ratelimit", 0, "max requests per second per AS (needs -asn-db)")
 	flag.IntVar(&opts.Attempts, "max-attempts", 2, "max attempts before marking a mismatching DNS test as failed")
+	flag.StringVar(&opts.RetryOn, "retry-on", "TIMEOUT,SERVFAIL,TC", "statuses worth retrying a DNS test (comma separated)")
+	flag.DurationVar(&opts.RetryBackoff, "retry-backoff", 0, "delay before a retry (pausing the server), doubled on each attempt, with jitter")
+	flag.StringVar(&opts.FastFail, "fast-fail", "", "statuses dropping a server at once (comma separated)")
 	flag.IntVar(&opts.MaxMismatches, "max-mismatches", 0, "max allowed mismatching tests per DNS server")
+	flag.StringVar(&opts.CheckOrder, "check-order", "template", "order of DNS tests (template|failures)")
+	flag.Float64Var(&opts.MinScore, "min-score", 0, "drop valid servers scoring below this (0-100)")
+	flag.BoolVar(&opts.Prefilter, "prefilter", false, "probe each server once first, and only test responsive ones")
+	flag.IntVar(&opts.PrefilterTimeout, "prefilter-timeout", 1, "timeout in seconds for -prefilter probes")
 	// TEMPLATE VALIDATION
-	flag.StringVar(&opts.Template, "template", "", "path to the DNSanity validation template")
+	flag.Var(&opts.Templates, "template", "path to the DNSanity validation template (repeatable)")
+	flag.StringVar(&opts.TemplateTags, "template-tags", "", "only run template entries with one of these tags")
 	flag.StringVar(&opts.TrustedDNS, "trusted-list", "8.8.8.8, 1.1.1.1, 9.9.9.9", "list of TRUSTED servers")
 	flag.IntVar(&opts.TrustedTimeout, "trusted-timeout", 2, "timeout in seconds for TRUSTED servers")
 	flag.Float64Var(&opts.TrustedRateLimit, "trusted-ratelimit", 10.0, "max requests per second per TRUSTED server")
 	flag.IntVar(&opts.TrustedAttempts, "trusted-max-attempts", 2, "max attempts before marking a mismatching TRUSTED test as failed")
+	flag.IntVar(&opts.TrustedQuorum, "trusted-quorum", 0, "min TRUSTED servers which must validate each template entry")
+	flag.BoolVar(&opts.PruneTemplate, "prune-template", false, "remove template entries failing TRUSTED validation instead of aborting")
+	flag.IntVar(&opts.MinTplEntries, "min-template-entries", 1, "min template entries left by -prune-template")
+	// DIFFERENTIAL MODE
+	flag.StringVar(&opts.DiffList, "diff-list", "", "domains to compare with TRUSTED servers answers")
+	flag.StringVar(&opts.DiffMatch, "diff-match", "prefix", "how A records are compared (exact|prefix|asn)")
+	flag.IntVar(&opts.DiffPrefix, "diff-prefix", 24, "IPv4 prefix length for prefix matching")
+	flag.IntVar(&opts.DiffPrefix6, "diff-prefix6", 48, "IPv6 prefix length for prefix matching")
+	flag.StringVar(&opts.ASNDBPath, "asn-db", "", "local IP to ASN database")
 	// DEBUG
 	flag.BoolVar(&opts.ShowHelp, "h", false, "show help")
 	// flag.BoolVar(&opts.ShowFullHelp, "full-help", false, "show advanced help")
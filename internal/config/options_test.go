@@ -153,8 +153,8 @@ func TestParseOptions(t *testing.T) {
 				if o.UntrustedDNS != "8.8.8.8" {
 					t.Fatalf("UntrustedDNS = %q, want 8.8.8.8", o.UntrustedDNS)
 				}
-				if o.Template != "tpl.txt" {
-					t.Fatalf("Template = %q, want tpl.txt", o.Template)
+				if len(o.Templates) != 1 || o.Templates[0] != "tpl.txt" {
+					t.Fatalf("Templates = %q, want [tpl.txt]", o.Templates)
 				}
 				if o.Threads != 16 {
 					t.Fatalf("Threads = %d, want 16", o.Threads)
@@ -4,14 +4,18 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"net"
+	"net/netip"
 	"os"
+	"regexp"
 	"strings"
+
+	"github.com/nil0x42/dnsanity/internal/netutil"
 )
 
 // ParseServerList parses input and returns the DNS server IP addresses it
 // contains. The input may be a comma‑separated string or a path to a file and
-// supports both IPv4 and IPv6 addresses.
+// supports both IPv4 and IPv6 addresses, with an optional port
+// ("192.0.2.1:5353", "[2001:db8::1]:5353").
 //
 // Example:
 //
@@ -19,12 +23,87 @@ import (
 //	ParseServerList("/tmp/srv.lst")
 func ParseServerList(input string) ([]string, error) {
 	var servers []string
+	err := forEachListItem(input, func(elem string) error {
+		if _, err := netutil.ParseServerAddr(elem); err != nil {
+			return err
+		}
+		servers = append(servers, elem)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("server list is empty")
+	}
+	return servers, nil
+}
+
+// NumDistinctServers returns the number of distinct servers of a list
+// returned by ParseServerList (duplicates are only sanitized once).
+func NumDistinctServers(servers []string) int {
+	seen := make(map[netip.AddrPort]struct{}, len(servers))
+	for _, elem := range servers {
+		if addr, err := netutil.ParseServerAddr(elem); err == nil {
+			seen[addr] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// ParseExcludeList parses input and returns the set of IPs, CIDRs and IP
+// ranges it contains. Like ParseServerList, input may be a
+// comma‑separated string or a file.
+func ParseExcludeList(input string) (*netutil.IPSet, error) {
+	var ranges []netutil.IPRange
+	err := forEachListItem(input, func(elem string) error {
+		r, err := netutil.ParseIPRange(elem)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("exclude list is empty")
+	}
+	return netutil.NewIPSet(ranges), nil
+}
+
+var domainRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*\.?$`)
+
+// ParseDomainList parses input and returns the domain names it contains.
+// Like ParseServerList, input may be a comma‑separated string or a file.
+func ParseDomainList(input string) ([]string, error) {
+	var domains []string
+	err := forEachListItem(input, func(elem string) error {
+		if !domainRegex.MatchString(elem) {
+			return fmt.Errorf("Invalid domain: %q", elem)
+		}
+		domains = append(domains, elem)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("domain list is empty")
+	}
+	return domains, nil
+}
+
+// forEachListItem calls fn for each element of a list given as a file
+// path or as a comma-separated string ('#' starts a comment).
+func forEachListItem(input string, fn func(elem string) error) error {
 	var scanner *bufio.Scanner
 
 	if st, err := os.Stat(input); err == nil && !st.IsDir() {
 		file, err := os.Open(input)
 		if err != nil {
-			return nil, fmt.Errorf("Can't open %q: %w", input, err)
+			return fmt.Errorf("Can't open %q: %w", input, err)
 		}
 		defer file.Close()
 		scanner = bufio.NewScanner(file)
@@ -43,14 +122,10 @@ func ParseServerList(input string) ([]string, error) {
 			if elem == "" {
 				continue
 			}
-			if ip := net.ParseIP(elem); ip == nil {
-				return nil, fmt.Errorf("Invalid IP: %q", elem)
+			if err := fn(elem); err != nil {
+				return err
 			}
-			servers = append(servers, elem)
 		}
 	}
-	if len(servers) == 0 {
-		return nil, errors.New("server list is empty")
-	}
-	return servers, nil
+	return nil
 }
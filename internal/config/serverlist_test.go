@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/netip"
 	"os"
 	"reflect"
 	"testing"
@@ -54,6 +55,16 @@ func TestParseServerList(t *testing.T) {
 			input: "2001:4860:4860::8888, 8.8.8.8",
 			want:  []string{"2001:4860:4860::8888", "8.8.8.8"},
 		},
+		{
+			name:  "servers with port",
+			input: "8.8.8.8:5353, [2001:4860:4860::8888]:53",
+			want:  []string{"8.8.8.8:5353", "[2001:4860:4860::8888]:53"},
+		},
+		{
+			name:    "invalid port",
+			input:   "8.8.8.8:0",
+			wantErr: true,
+		},
 		{
 			name:    "invalid IP in inline list",
 			input:   "8.8.8.8,999.999.999.999",
@@ -105,3 +116,55 @@ func TestParseServerList(t *testing.T) {
 		})
 	}
 }
+
+func TestNumDistinctServers(t *testing.T) {
+	servers := []string{"8.8.8.8", "1.1.1.1", "8.8.8.8", "8.8.8.8:5353", "1.1.1.1"}
+	if got := NumDistinctServers(servers); got != 3 {
+		t.Errorf("NumDistinctServers(%v) = %d, want 3", servers, got)
+	}
+}
+
+func TestParseDomainList(t *testing.T) {
+	path := createTempFile(t, "# geo-located domains\nwww.google.com\ncdn.example.net., _dmarc.example.org\n")
+	got, err := ParseDomainList(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"www.google.com", "cdn.example.net.", "_dmarc.example.org"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch; got %v, want %v", got, want)
+	}
+	for _, bad := range []string{"# nothing", "bad domain.com", "a..b", "http://x.com"} {
+		if _, err := ParseDomainList(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseExcludeList(t *testing.T) {
+	set, err := ParseExcludeList(createTempFile(t, `
+        # bad neighbours
+        203.0.113.0/24, 198.51.100.7
+        2001:db8::1-2001:db8::ff
+    `))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for ip, want := range map[string]bool{
+		"203.0.113.42":   true,
+		"198.51.100.7":   true,
+		"198.51.100.8":   false,
+		"2001:db8::80":   true,
+		"2001:db8::100":  false,
+		"::ffff:1.2.3.4": false,
+	} {
+		if got := set.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	for _, bad := range []string{"1.2.3.4/33", "nope", "# empty"} {
+		if _, err := ParseExcludeList(bad); err == nil {
+			t.Errorf("ParseExcludeList(%q): expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+// SourceOptions tells how a ServerSource reads its entries.
+type SourceOptions struct {
+	Skip         func(ip string) bool // servers to ignore (nil: none)
+	MaxRangeSize uint64               // max addresses per CIDR/range (0: no ranges)
+	SkipNetBcast bool                 // skip network/broadcast of IPv4 CIDRs
+	Exclude      *netutil.IPSet       // servers to filter out (nil: none)
+	AllowSpecial bool                 // keep special-purpose addresses
+	Shard        Shard                // subset of servers to keep (-shard)
+}
+
+// ServerSource lazily reads DNS server IPs from a file, STDIN or a
+// comma-separated string, so that huge lists never sit in memory.
+// Entries may be IPs, IPs with a port ("192.0.2.1:5353"), CIDRs or
+// ranges ("192.0.2.10-192.0.2.50"), which are expanded one address at a
+// time. Servers are validated and
+// deduplicated as they are read: duplicates are skipped, and counted.
+// So are excluded and special-purpose addresses (private, loopback,
+// multicast...), unless opts.AllowSpecial is set.
+// Servers out of opts.Shard are silently ignored, like opts.Skip ones.
+// An invalid entry is an error: seekable files and inline lists are
+// rejected by a pre-pass, and pipes stop being read at this entry (see
+// Err()).
+//
+// Total() is known upfront for seekable files and inline lists (counted
+// by the pre-pass), and only at EOF for pipes, whose lines are read by
+// a goroutine (so that TryNext() never blocks).
+// All methods are single-goroutine – no mutex needed.
+type ServerSource struct {
+	name    string
+	opts    SourceOptions
+	closer  io.Closer
+	scanner *bufio.Scanner
+	lines   chan string   // lines read by readLines() (nil: use scanner)
+	ready   chan struct{} // signaled when lines are sent or closed
+	quit    chan struct{} // stops readLines()
+	readErr error         // error of readLines(), set before closing lines
+	lineNo  int           // number of lines read
+	line    []string      // elems of current line, not read yet
+	unread  string        // server to return again by Next()
+
+	cur, last netip.Addr // range being expanded (cur invalid if none)
+	port      uint16     // port of range being expanded (0: default)
+
+	seen     map[netip.AddrPort]struct{} // deduplication
+	estimate int                         // pre-pass count (-1: unknown)
+	yielded  int                         // servers returned by Next()
+	dups     int                         // duplicates skipped
+	filtered map[string]int              // filtered servers, by reason
+	eof      bool
+	err      error
+}
+
+// OpenServerSource opens a server list given as a file path (including
+// /dev/stdin) or as a comma-separated string ('#' starts a comment).
+func OpenServerSource(input string, opts SourceOptions) (*ServerSource, error) {
+	var reader io.ReadSeeker
+	name := "list"
+	if st, err := os.Stat(input); err == nil && !st.IsDir() {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, fmt.Errorf("Can't open %q: %w", input, err)
+		}
+		if !st.Mode().IsRegular() { // pipe, char device...: can't be read twice
+			ss := newStreamSource(file, input, opts)
+			ss.startReader()
+			// wait for 1st server, to fail fast on empty input
+			ip, ok := ss.Next()
+			if !ok {
+				err := ss.Err()
+				if err == nil {
+					nFiltered := 0
+					for _, n := range ss.filtered {
+						nFiltered += n
+					}
+					err = errEmptyList(nFiltered)
+				}
+				ss.Close()
+				return nil, err
+			}
+			ss.unread = ip
+			return ss, nil
+		}
+		reader, name = file, input
+	} else {
+		reader = strings.NewReader(input)
+	}
+	ss := newStreamSource(reader, name, opts)
+	// cheap pre-pass: count (and validate) entries, then rewind
+	count, nFiltered, err := ss.prePass(reader)
+	if err == nil && count == 0 {
+		err = errEmptyList(nFiltered)
+	}
+	if err == nil {
+		if _, err = reader.Seek(0, io.SeekStart); err != nil {
+			err = fmt.Errorf("Can't read %q: %w", input, err)
+		}
+	}
+	if err != nil {
+		ss.Close()
+		return nil, err
+	}
+	ss.estimate = count
+	ss.scanner = bufio.NewScanner(reader)
+	return ss, nil
+}
+
+// newStreamSource returns a ServerSource reading r once, without
+// pre-pass (total unknown until EOF). r is closed by Close() if possible.
+func newStreamSource(r io.Reader, name string, opts SourceOptions) *ServerSource {
+	ss := &ServerSource{
+		name:     name,
+		opts:     opts,
+		scanner:  bufio.NewScanner(r),
+		seen:     make(map[netip.AddrPort]struct{}),
+		filtered: make(map[string]int),
+		estimate: -1,
+	}
+	if closer, ok := r.(io.Closer); ok {
+		ss.closer = closer
+	}
+	return ss
+}
+
+// NewServerSourceFromList returns a ServerSource yielding ips, which are
+// expected to be valid already (e.g. from ParseServerList()).
+func NewServerSourceFromList(ips []string) *ServerSource {
+	ss := newStreamSource(
+		strings.NewReader(strings.Join(ips, "\n")), "list", SourceOptions{})
+	ss.opts.AllowSpecial = true
+	ss.estimate = len(ips)
+	return ss
+}
+
+// Subset returns a ServerSource reading n servers from r, one per line
+// (servers read from ss, e.g. the responsive ones, spooled to a file),
+// which still reports the skipped & filtered entries and the read error
+// of ss. r is closed by Close() if possible.
+func (ss *ServerSource) Subset(r io.Reader, n int) *ServerSource {
+	sub := newStreamSource(r, ss.name, SourceOptions{AllowSpecial: true})
+	sub.dups, sub.filtered, sub.err = ss.dups, ss.filtered, ss.err
+	sub.estimate = n + ss.dups // (estimate includes them)
+	return sub
+}
+
+// startReader makes a goroutine read the lines of ss (a pipe), so that
+// TryNext() can tell when no server is available yet instead of
+// blocking. At most cap(ss.lines) lines are read ahead.
+func (ss *ServerSource) startReader() {
+	ss.lines = make(chan string, 1024)
+	ss.ready = make(chan struct{}, 1)
+	ss.quit = make(chan struct{})
+	go ss.readLines(ss.scanner)
+}
+
+// readLines sends the lines of scanner to ss.lines until EOF or Close().
+func (ss *ServerSource) readLines(scanner *bufio.Scanner) {
+	signal := func() {
+		select {
+		case ss.ready <- struct{}{}:
+		default: // (already signaled)
+		}
+	}
+	defer signal()
+	defer close(ss.lines)
+	for scanner.Scan() {
+		select {
+		case ss.lines <- scanner.Text():
+			signal()
+		case <-ss.quit:
+			return
+		}
+	}
+	ss.readErr = scanner.Err()
+}
+
+// parseEntry parses a list entry as an IPRange (and its port, if set),
+// honouring opts.
+func (ss *ServerSource) parseEntry(elem string) (netutil.IPRange, uint16, error) {
+	if addr, err := netutil.ParseServerAddr(elem); err == nil {
+		ip := addr.Addr()
+		return netutil.IPRange{First: ip, Last: ip, Bits: -1}, addr.Port(), nil
+	}
+	r, err := netutil.ParseIPRange(elem)
+	if err != nil {
+		return r, 0, err
+	}
+	if r.First != r.Last {
+		if ss.opts.SkipNetBcast {
+			r = r.WithoutNetBcast()
+		}
+		if size := r.Size(); size > ss.opts.MaxRangeSize {
+			return r, 0, fmt.Errorf("Range too large: %q (%d > %d addresses)",
+				elem, size, ss.opts.MaxRangeSize)
+		}
+	}
+	return r, 0, nil
+}
+
+// ErrEmptyList is returned by OpenServerSource if the list yields no
+// server (possibly because all of them were filtered out or skipped).
+var ErrEmptyList = errors.New("server list is empty")
+
+// errEmptyList returns ErrEmptyList, telling why if servers were
+// filtered out.
+func errEmptyList(nFiltered int) error {
+	if nFiltered > 0 {
+		return fmt.Errorf("%w (%d filtered out, see -exclude & -allow-special)",
+			ErrEmptyList, nFiltered)
+	}
+	return ErrEmptyList
+}
+
+// prePass counts the servers of r (and those filtered out), failing on
+// the first invalid entry.
+func (ss *ServerSource) prePass(r io.Reader) (count, nFiltered int, err error) {
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		for _, elem := range splitListLine(scanner.Text()) {
+			r, port, err := ss.parseEntry(elem)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%w (%s line %d)", err, ss.name, lineNo)
+			}
+			if ss.opts.Skip == nil && ss.opts.Exclude == nil &&
+				ss.opts.AllowSpecial && ss.opts.Shard.NumShards <= 1 {
+				count += int(r.Size())
+				continue
+			}
+			for ip := r.First; ip.IsValid() && !r.Last.Less(ip); ip = ip.Next() {
+				if ss.filter(ip) != "" {
+					nFiltered++
+				} else if !ss.skip(netutil.FormatServerAddr(
+					netip.AddrPortFrom(ip, port))) {
+					count++
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("Can't read %q: %w", ss.name, err)
+	}
+	return count, nFiltered, nil
+}
+
+// filter returns why ip must be filtered out ("" if it must not).
+func (ss *ServerSource) filter(ip netip.Addr) string {
+	if ss.opts.Exclude != nil && ss.opts.Exclude.Contains(ip) {
+		return "excluded"
+	}
+	if !ss.opts.AllowSpecial {
+		if reason, ok := netutil.SpecialPurpose(ip); ok {
+			return reason
+		}
+	}
+	return ""
+}
+
+// skip returns true if ip must be silently ignored (opts.Skip, or out
+// of opts.Shard).
+func (ss *ServerSource) skip(ip string) bool {
+	return !ss.opts.Shard.Contains(ip) ||
+		(ss.opts.Skip != nil && ss.opts.Skip(ip))
+}
+
+// splitListLine returns the non-empty comma-separated elems of a line.
+func splitListLine(line string) []string {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = line[:idx]
+	}
+	var elems []string
+	for _, elem := range strings.Split(line, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// nextLine returns the next line of the list. If block is false and
+// the next line of a pipe isn't read yet, ok is false while ss.eof
+// isn't set.
+func (ss *ServerSource) nextLine(block bool) (line string, ok bool) {
+	if ss.lines == nil {
+		if ss.scanner.Scan() {
+			ss.lineNo++
+			return ss.scanner.Text(), true
+		}
+		ss.eof = true
+		if err := ss.scanner.Err(); err != nil {
+			ss.err = fmt.Errorf("Can't read %q: %w", ss.name, err)
+		}
+		return "", false
+	}
+	if block {
+		line, ok = <-ss.lines
+	} else {
+		select {
+		case line, ok = <-ss.lines:
+		default:
+			return "", false // not read yet
+		}
+	}
+	if ok {
+		ss.lineNo++
+		return line, true
+	}
+	ss.eof = true
+	if ss.readErr != nil {
+		ss.err = fmt.Errorf("Can't read %q: %w", ss.name, ss.readErr)
+	}
+	return "", false
+}
+
+// nextAddr returns the next address to consider, expanding ranges.
+// ok is false at the end of the list, or if block is false and the
+// next line of a pipe isn't read yet (ss.eof not set).
+func (ss *ServerSource) nextAddr(block bool) (addr netip.AddrPort, ok bool) {
+	for {
+		if ss.cur.IsValid() { // expanding a range
+			addr = netip.AddrPortFrom(ss.cur, ss.port)
+			if ss.cur == ss.last {
+				ss.cur = netip.Addr{}
+			} else {
+				ss.cur = ss.cur.Next()
+			}
+			return addr, true
+		}
+		if len(ss.line) > 0 {
+			elem := ss.line[0]
+			ss.line = ss.line[1:]
+			r, port, err := ss.parseEntry(elem)
+			if err != nil { // (only pipes, others passed the pre-pass)
+				ss.err = fmt.Errorf("%w (%s line %d)", err, ss.name, ss.lineNo)
+				ss.line, ss.eof = nil, true
+				return addr, false
+			}
+			ss.cur, ss.last, ss.port = r.First, r.Last, port
+			continue
+		}
+		if ss.eof {
+			return addr, false
+		}
+		line, ok := ss.nextLine(block)
+		if !ok {
+			return addr, false
+		}
+		ss.line = splitListLine(line)
+	}
+}
+
+// Next returns the next valid, not yet seen server IP.
+// ok is false once the list is exhausted (see Err()).
+func (ss *ServerSource) Next() (ip string, ok bool) {
+	return ss.next(true)
+}
+
+// TryNext is like Next, but never waits for a pipe: ok is also false if
+// no server is read yet, in which case Exhausted() is false, and Ready()
+// is signaled once more lines are read.
+func (ss *ServerSource) TryNext() (ip string, ok bool) {
+	return ss.next(false)
+}
+
+// Ready returns a channel signaled when new lines are read from a pipe
+// (nil for other sources, as TryNext() never waits for them).
+func (ss *ServerSource) Ready() <-chan struct{} {
+	return ss.ready
+}
+
+// Exhausted reports whether every server was read from the list.
+func (ss *ServerSource) Exhausted() bool {
+	return ss.eof && len(ss.line) == 0 && !ss.cur.IsValid() && ss.unread == ""
+}
+
+func (ss *ServerSource) next(block bool) (ip string, ok bool) {
+	if ss.unread != "" {
+		ip, ss.unread = ss.unread, ""
+		return ip, true
+	}
+	for {
+		addr, ok := ss.nextAddr(block)
+		if !ok {
+			return "", false
+		}
+		if reason := ss.filter(addr.Addr()); reason != "" {
+			ss.filtered[reason]++
+			continue
+		}
+		ip = netutil.FormatServerAddr(addr)
+		if ss.skip(ip) {
+			continue
+		}
+		if _, dup := ss.seen[addr]; dup {
+			ss.dups++
+			continue
+		}
+		ss.seen[addr] = struct{}{}
+		ss.yielded++
+		return ip, true
+	}
+}
+
+// Unread makes ip (returned by the last call to Next) the next server
+// returned by Next. It is still counted as read.
+func (ss *ServerSource) Unread(ip string) {
+	ss.unread = ip
+}
+
+// Total returns the number of servers the list yields. known is false
+// when it can't be told before EOF (in which case, servers read so far).
+func (ss *ServerSource) Total() (total int, known bool) {
+	switch {
+	case ss.eof && len(ss.line) == 0 && !ss.cur.IsValid():
+		return ss.yielded, true
+	case ss.estimate >= 0:
+		return max(ss.estimate-ss.dups, ss.yielded), true
+	default:
+		return ss.yielded, false
+	}
+}
+
+// Remaining returns how many servers may still be read (0 if unknown).
+func (ss *ServerSource) Remaining() int {
+	total, _ := ss.Total()
+	return total - ss.yielded
+}
+
+// WriteUnread writes the entries not read yet to w, one per line, as list
+// entries (ranges are not expanded, and the rest of a range being
+// expanded is written as "first-last"), e.g. for servers left untested.
+// Lines of a pipe which aren't read yet are not waited for (it could
+// block), in which case complete is false.
+func (ss *ServerSource) WriteUnread(w io.Writer) (complete bool, err error) {
+	bw := bufio.NewWriter(w)
+	if ss.unread != "" {
+		fmt.Fprintln(bw, ss.unread)
+	}
+	if ss.cur.IsValid() {
+		if ss.cur == ss.last {
+			fmt.Fprintln(bw, netutil.FormatServerAddr(
+				netip.AddrPortFrom(ss.cur, ss.port)))
+		} else {
+			fmt.Fprintf(bw, "%s-%s\n", ss.cur, ss.last)
+		}
+	}
+	for _, elem := range ss.line {
+		fmt.Fprintln(bw, elem)
+	}
+	for !ss.eof {
+		line, ok := ss.nextLine(false)
+		if !ok {
+			break // (pipe: next line not read yet)
+		}
+		for _, elem := range splitListLine(line) {
+			fmt.Fprintln(bw, elem)
+		}
+	}
+	complete = ss.eof
+	ss.unread, ss.cur, ss.line = "", netip.Addr{}, nil
+	return complete, bw.Flush()
+}
+
+// Skipped returns the number of duplicates skipped.
+func (ss *ServerSource) Skipped() (dups int) {
+	return ss.dups
+}
+
+// Filtered returns the number of servers filtered out, by reason
+// ("excluded", "private", "loopback"...).
+func (ss *ServerSource) Filtered() map[string]int {
+	return ss.filtered
+}
+
+// Err returns the read error which ended the list, if any.
+func (ss *ServerSource) Err() error {
+	return ss.err
+}
+
+// Close stops reading, and closes the underlying file (if any).
+func (ss *ServerSource) Close() error {
+	if ss.quit != nil {
+		close(ss.quit)
+		ss.quit = nil
+	}
+	if ss.closer != nil {
+		return ss.closer.Close()
+	}
+	return nil
+}
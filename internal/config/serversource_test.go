@@ -0,0 +1,390 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readAll drains a ServerSource, checking Total() never goes below the
+// number of servers read so far.
+func readAll(t *testing.T, ss *ServerSource) []string {
+	t.Helper()
+	var ips []string
+	for ip, ok := ss.Next(); ok; ip, ok = ss.Next() {
+		ips = append(ips, ip)
+		if total, _ := ss.Total(); total < len(ips) {
+			t.Fatalf("Total()=%d < %d servers read", total, len(ips))
+		}
+	}
+	return ips
+}
+
+func TestServerSourceFile(t *testing.T) {
+	path := createTempFile(t, `
+        # comment line
+        8.8.8.8 ,  1.1.1.1  # inline comment
+        2001:4860:4860::8888
+        8.8.8.8, 9.9.9.9,
+        ,,,,
+    `)
+	ss, err := OpenServerSource(path, SourceOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ss.Close()
+	// pre-pass: 5 entries, duplicates not known yet
+	if total, known := ss.Total(); total != 5 || !known {
+		t.Fatalf("Total() before read = %d,%v, want 5,true", total, known)
+	}
+	got := readAll(t, ss)
+	want := []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888", "9.9.9.9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if total, known := ss.Total(); total != 4 || !known {
+		t.Fatalf("Total() after read = %d,%v, want 4,true", total, known)
+	}
+	if dups := ss.Skipped(); dups != 1 {
+		t.Fatalf("Skipped() = %d, want 1", dups)
+	}
+	if ss.Err() != nil {
+		t.Fatalf("unexpected Err(): %v", ss.Err())
+	}
+}
+
+func TestServerSourceInlineAndErrors(t *testing.T) {
+	ss, err := OpenServerSource("8.8.8.8,1.1.1.1,8.8.8.8", SourceOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8", "1.1.1.1"}) {
+		t.Fatalf("got %v", got)
+	}
+	for _, bad := range []string{
+		"8.8.8.8,999.999.999.999", // invalid IP
+		"fe80::1%eth0",            // zones are not allowed
+		"   # just a comment",     // empty
+		".",                       // directory treated as string
+		"1.1.1.1:99999",           // invalid port
+		"10.0.0.0/30:53",          // no port on ranges
+	} {
+		if _, err := OpenServerSource(bad, SourceOptions{}); err == nil {
+			t.Errorf("OpenServerSource(%q): expected error", bad)
+		}
+	}
+	_, err = OpenServerSource(createTempFile(t, "1.1.1.1\nnope\n"), SourceOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error with line number, got %v", err)
+	}
+}
+
+func TestServerSourcePorts(t *testing.T) {
+	ss, err := OpenServerSource(
+		"127.0.0.1:5353,127.0.0.1,127.0.0.1:53,127.0.0.1:5353,[::1]:5353",
+		SourceOptions{AllowSpecial: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"127.0.0.1:5353", "127.0.0.1", "127.0.0.1:53", "[::1]:5353"}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// filters apply to the IP, whatever the port
+	ss, err = OpenServerSource("127.0.0.1:5353,8.8.8.8:53", SourceOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8:53"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestServerSourceSubset(t *testing.T) {
+	ss, err := OpenServerSource("8.8.8.8,1.1.1.1,8.8.8.8,10.0.0.1", SourceOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readAll(t, ss)
+	sub := ss.Subset(strings.NewReader("1.1.1.1\n"), 1)
+	if total, known := sub.Total(); total != 1 || !known {
+		t.Errorf("Total() = %d, %v; want 1, true", total, known)
+	}
+	if got := readAll(t, sub); !reflect.DeepEqual(got, []string{"1.1.1.1"}) {
+		t.Errorf("got %v", got)
+	}
+	if dups := sub.Skipped(); dups != 1 {
+		t.Errorf("expected parent's duplicate to be reported, got %d", dups)
+	}
+	if n := sub.Filtered()["private"]; n != 1 {
+		t.Errorf("expected parent's filtered server to be reported, got %v", sub.Filtered())
+	}
+}
+
+func TestServerSourceSkip(t *testing.T) {
+	done := map[string]bool{"1.1.1.1": true}
+	ss, err := OpenServerSource("1.1.1.1, 8.8.8.8", SourceOptions{
+		Skip: func(ip string) bool { return done[ip] },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total, _ := ss.Total(); total != 1 {
+		t.Fatalf("skipped servers must not be counted: Total()=%d", total)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8"}) {
+		t.Fatalf("got %v", got)
+	}
+	// all servers skipped: the list is empty
+	if _, err := OpenServerSource("1.1.1.1", SourceOptions{
+		Skip: func(string) bool { return true },
+	}); err == nil {
+		t.Fatal("expected empty list error")
+	}
+}
+
+// TestServerSourceShard checks that shards of a list (in any order)
+// yield disjoint subsets covering it, with exact totals.
+func TestServerSourceShard(t *testing.T) {
+	list := "10.0.0.0/26, 10.0.1.1:5353"
+	reversed := "10.0.1.1:5353\n" // same servers, another order
+	for i := 63; i >= 0; i-- {
+		reversed += fmt.Sprintf("10.0.0.%d\n", i)
+	}
+	seen := map[string]bool{}
+	for idx := 1; idx <= 3; idx++ {
+		opts := SourceOptions{MaxRangeSize: 256, AllowSpecial: true,
+			Shard: Shard{Index: idx, NumShards: 3}}
+		ss, err := OpenServerSource(list, opts)
+		if err != nil {
+			t.Fatalf("shard %d: unexpected error: %v", idx, err)
+		}
+		total, _ := ss.Total()
+		got := readAll(t, ss)
+		if len(got) != total {
+			t.Fatalf("shard %d: Total()=%d, but read %d servers", idx, total, len(got))
+		}
+		ss, err = OpenServerSource(createTempFile(t, reversed), opts)
+		if err != nil {
+			t.Fatalf("shard %d: unexpected error: %v", idx, err)
+		}
+		gotReversed := readAll(t, ss)
+		sort.Strings(got)
+		sort.Strings(gotReversed)
+		if !reflect.DeepEqual(got, gotReversed) {
+			t.Fatalf("shard %d depends on list order: %v != %v", idx, got, gotReversed)
+		}
+		for _, ip := range got {
+			if seen[ip] {
+				t.Fatalf("%s is in several shards", ip)
+			}
+			seen[ip] = true
+		}
+	}
+	if len(seen) != 65 {
+		t.Fatalf("shards yield %d servers, want 65", len(seen))
+	}
+}
+
+func TestServerSourceRanges(t *testing.T) {
+	opts := SourceOptions{MaxRangeSize: 256, AllowSpecial: true}
+	ss, err := OpenServerSource(
+		"192.0.2.0/30, 10.0.0.1-10.0.0.2\n10.0.0.2, 2001:db8::/127", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total, known := ss.Total(); total != 9 || !known {
+		t.Fatalf("Total() = %d,%v, want 9,true", total, known)
+	}
+	want := []string{
+		"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3",
+		"10.0.0.1", "10.0.0.2", "2001:db8::", "2001:db8::1",
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v", got)
+	}
+	if total, known := ss.Total(); total != 8 || !known {
+		t.Fatalf("Total() at EOF = %d,%v, want 8,true", total, known)
+	}
+
+	// network & broadcast addresses skipped
+	opts.SkipNetBcast = true
+	ss, err = OpenServerSource("192.0.2.0/30", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	// expansion cap
+	_, err = OpenServerSource("8.8.8.8\n10.0.0.0/16", opts)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected range too large error with line number, got %v", err)
+	}
+	if _, err = OpenServerSource("10.0.0.0/24", SourceOptions{}); err == nil {
+		t.Error("ranges must be refused when MaxRangeSize is 0")
+	}
+	ss = newStreamSource(strings.NewReader("8.8.8.8\n10.0.0.0/8\n1.1.1.1\n"), "stdin", opts)
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8"}) {
+		t.Fatalf("got %v", got)
+	}
+	if err := ss.Err(); err == nil || !strings.Contains(err.Error(), "stdin line 2") {
+		t.Fatalf("oversized range must stop the stream with an error, got %v", err)
+	}
+}
+
+func TestServerSourceFilter(t *testing.T) {
+	exclude, err := ParseExcludeList("8.8.4.0/24, 9.9.9.9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list := "8.8.8.8, 10.1.2.3, 127.0.0.1, 8.8.4.4\n" +
+		"192.168.1.1, 224.0.0.1, 192.0.2.1, ::1, 9.9.9.9, 1.1.1.1"
+	ss, err := OpenServerSource(list, SourceOptions{Exclude: exclude})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total, _ := ss.Total(); total != 2 {
+		t.Fatalf("filtered servers must not be counted: Total()=%d", total)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8", "1.1.1.1"}) {
+		t.Fatalf("got %v", got)
+	}
+	want := map[string]int{
+		"excluded": 2, "private": 2, "loopback": 2,
+		"multicast": 1, "documentation": 1,
+	}
+	if got := ss.Filtered(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Filtered() = %v, want %v", got, want)
+	}
+
+	// special-purpose addresses allowed
+	ss, err = OpenServerSource("10.1.2.3, 8.8.4.4", SourceOptions{
+		Exclude: exclude, AllowSpecial: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"10.1.2.3"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	// everything filtered: the list is empty
+	if _, err := OpenServerSource("127.0.0.1", SourceOptions{}); err == nil {
+		t.Fatal("expected empty list error")
+	}
+}
+
+func TestServerSourceStream(t *testing.T) {
+	ss := newStreamSource(strings.NewReader(
+		"8.8.8.8\n1.1.1.1\n8.8.8.8\nbad-ip\n9.9.9.9\n"), "stdin", SourceOptions{})
+	if total, known := ss.Total(); total != 0 || known {
+		t.Fatalf("stream Total() = %d,%v, want 0,false", total, known)
+	}
+	ip, ok := ss.Next()
+	if !ok || ip != "8.8.8.8" {
+		t.Fatalf("Next() = %q,%v", ip, ok)
+	}
+	if total, known := ss.Total(); total != 1 || known {
+		t.Fatalf("stream Total() = %d,%v, want 1,false", total, known)
+	}
+	// an invalid entry ends the list, like the pre-pass of files
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"1.1.1.1"}) {
+		t.Fatalf("got %v", got)
+	}
+	if err := ss.Err(); err == nil || !strings.Contains(err.Error(), "stdin line 4") {
+		t.Fatalf("expected invalid entry error with line number, got %v", err)
+	}
+	if total, known := ss.Total(); total != 2 || !known {
+		t.Fatalf("Total() at EOF = %d,%v, want 2,true", total, known)
+	}
+	if dups := ss.Skipped(); dups != 1 {
+		t.Fatalf("Skipped() = %d, want 1", dups)
+	}
+}
+
+func TestServerSourcePipe(t *testing.T) {
+	r, w := io.Pipe()
+	ss := newStreamSource(r, "stdin", SourceOptions{})
+	ss.startReader()
+	defer ss.Close()
+	if _, ok := ss.TryNext(); ok || ss.Exhausted() {
+		t.Fatal("TryNext() must not wait for the pipe")
+	}
+	w.Write([]byte("8.8.8.8, 1.1.1.1\n"))
+	<-ss.Ready()
+	for _, want := range []string{"8.8.8.8", "1.1.1.1"} {
+		if ip, ok := ss.TryNext(); !ok || ip != want {
+			t.Fatalf("TryNext() = %q,%v, want %q,true", ip, ok, want)
+		}
+	}
+	if _, ok := ss.TryNext(); ok || ss.Exhausted() {
+		t.Fatal("TryNext() must not wait for the pipe")
+	}
+	w.Close()
+	<-ss.Ready()
+	if _, ok := ss.TryNext(); ok || !ss.Exhausted() {
+		t.Fatal("source must be exhausted once the pipe is closed")
+	}
+	if total, known := ss.Total(); total != 2 || !known {
+		t.Fatalf("Total() at EOF = %d,%v, want 2,true", total, known)
+	}
+}
+
+func TestServerSourceFromList(t *testing.T) {
+	ss := NewServerSourceFromList([]string{"8.8.8.8", "1.1.1.1"})
+	if total, known := ss.Total(); total != 2 || !known {
+		t.Fatalf("Total() = %d,%v", total, known)
+	}
+	if got := readAll(t, ss); !reflect.DeepEqual(got, []string{"8.8.8.8", "1.1.1.1"}) {
+		t.Fatalf("got %v", got)
+	}
+	if _, ok := NewServerSourceFromList(nil).Next(); ok {
+		t.Fatal("empty list must yield nothing")
+	}
+}
+
+func TestServerSourceWriteUnread(t *testing.T) {
+	opts := SourceOptions{MaxRangeSize: 1 << 24, AllowSpecial: true}
+	ss, err := OpenServerSource(
+		"8.8.8.8, 10.0.0.0/8, 1.1.1.1:5353\n# comment\n192.0.2.0/24, 9.9.9.9\n", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range 3 {
+		ss.Next()
+	}
+	ip, _ := ss.Next()
+	ss.Unread(ip)
+	var buf strings.Builder
+	complete, err := ss.WriteUnread(&buf)
+	if err != nil || !complete {
+		t.Fatalf("WriteUnread() = %v,%v, want true,nil", complete, err)
+	}
+	// ranges are not expanded (a /8 remains a single line)
+	want := "10.0.0.2\n10.0.0.3-10.255.255.255\n1.1.1.1:5353\n192.0.2.0/24\n9.9.9.9\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+	if _, ok := ss.Next(); ok {
+		t.Fatal("source must be exhausted after WriteUnread()")
+	}
+
+	// pipes are not waited for
+	r, w := io.Pipe()
+	ss = newStreamSource(r, "stdin", opts)
+	ss.startReader()
+	defer ss.Close()
+	go w.Write([]byte("8.8.8.8, 1.1.1.1\n"))
+	ss.Next()
+	buf.Reset()
+	complete, err = ss.WriteUnread(&buf)
+	if err != nil || complete || buf.String() != "1.1.1.1\n" {
+		t.Fatalf("stream WriteUnread() = %q,%v,%v, want \"1.1.1.1\\n\",false,nil",
+			buf.String(), complete, err)
+	}
+}
@@ -1,21 +1,57 @@
 package config
 
 import (
+	"time"
+
 	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/netutil"
 )
 
 type Settings struct {
 	// global
 	ServerIPs     []string
+	ServerSource  *ServerSource // lazily read servers (overrides ServerIPs)
 	Template      dns.Template
 	MaxThreads    int
 	MaxPoolSize   int
 	GlobRateLimit int
+	Resolver      dns.Resolver // sends DNS queries (nil: dns.UDPResolver)
+	// per network
+	NetRateLimit float64        // max req/s per network prefix (0: off)
+	NetPrefix4   int            // IPv4 network prefix length
+	NetPrefix6   int            // IPv6 network prefix length
+	ASNRateLimit float64        // max req/s per AS (0: off)
+	ASNDB        *netutil.ASNDB // needed by ASNRateLimit
 	// per server
-	PerSrvRateLimit   float64
-	PerSrvMaxFailures int
+	PerSrvRateLimit    float64
+	PerSrvAdaptiveRate bool    // adapt rate limit (AIMD) between min & max
+	PerSrvMinRateLimit float64 // (adaptive) lowest rate limit
+	PerSrvMaxRateLimit float64 // (adaptive) highest rate limit
+	PerSrvMaxFailures  int
+	PerSrvCheckOrder   bool    // run most failing checks first on new servers
+	PerSrvMinScore     float64 // drop finished servers scoring below (0: off)
 	// per check
 	PerCheckMaxAttempts int
+	RetryOn             []string      // statuses worth a retry (nil: default)
+	RetryBackoff        time.Duration // delay before 1st retry (0: none)
+	FastFail            []string      // statuses dropping a server at once
 	// per dns query
 	PerQueryTimeout int
 }
+
+// Servers returns the servers to sanitize, as a ServerSource.
+func (s *Settings) Servers() *ServerSource {
+	if s.ServerSource == nil {
+		s.ServerSource = NewServerSourceFromList(s.ServerIPs)
+	}
+	return s.ServerSource
+}
+
+// NumServers returns the number of servers to sanitize. known is false
+// if it can't be told before the whole source is read.
+func (s *Settings) NumServers() (n int, known bool) {
+	if s.ServerSource == nil {
+		return len(s.ServerIPs), true
+	}
+	return s.ServerSource.Total()
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard selects one of NumShards disjoint subsets of a server list
+// (-shard i/n). Servers are assigned by hash of their address, so that
+// shards don't depend on the list order, and don't overlap.
+type Shard struct {
+	Index     int // 1-based
+	NumShards int // 0: no sharding
+}
+
+// ParseShard parses a shard given as "i/n" (1 <= i <= n).
+func ParseShard(s string) (Shard, error) {
+	idx, num, found := strings.Cut(s, "/")
+	if !found {
+		return Shard{}, fmt.Errorf("Invalid shard: %q (expected i/n)", s)
+	}
+	i, errI := strconv.Atoi(idx)
+	n, errN := strconv.Atoi(num)
+	if errI != nil || errN != nil {
+		return Shard{}, fmt.Errorf("Invalid shard: %q (expected i/n)", s)
+	}
+	if n < 1 || i < 1 || i > n {
+		return Shard{}, fmt.Errorf("Invalid shard: %q (i must be between 1 and n)", s)
+	}
+	return Shard{Index: i, NumShards: n}, nil
+}
+
+// Contains returns true if server ip (as formatted by
+// netutil.FormatServerAddr) belongs to the shard.
+func (sh Shard) Contains(ip string) bool {
+	if sh.NumShards <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return int(h.Sum32()%uint32(sh.NumShards)) == sh.Index-1
+}
+
+// String returns the shard as "i/n".
+func (sh Shard) String() string {
+	return fmt.Sprintf("%d/%d", sh.Index, sh.NumShards)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	sh, err := ParseShard("2/5")
+	if err != nil || sh != (Shard{Index: 2, NumShards: 5}) || sh.String() != "2/5" {
+		t.Fatalf("ParseShard(2/5) = %+v, %v", sh, err)
+	}
+	for _, bad := range []string{"", "2", "0/3", "4/3", "1/0", "a/b", "-1/2"} {
+		if _, err := ParseShard(bad); err == nil {
+			t.Errorf("ParseShard(%q): expected error", bad)
+		}
+	}
+}
+
+// TestShardContains checks that shards are disjoint, cover all servers,
+// and are reasonably balanced.
+func TestShardContains(t *testing.T) {
+	const numShards, numServers = 4, 4000
+	counts := make([]int, numShards)
+	for i := 0; i < numServers; i++ {
+		ip := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		matches := 0
+		for idx := 1; idx <= numShards; idx++ {
+			if (Shard{Index: idx, NumShards: numShards}).Contains(ip) {
+				matches++
+				counts[idx-1]++
+			}
+		}
+		if matches != 1 {
+			t.Fatalf("%s is in %d shards, want 1", ip, matches)
+		}
+	}
+	for idx, n := range counts {
+		if n < numServers/numShards/2 {
+			t.Errorf("shard %d/%d is unbalanced: %d servers", idx+1, numShards, n)
+		}
+	}
+	if !(Shard{}).Contains("8.8.8.8") {
+		t.Error("zero Shard must contain every server")
+	}
+}
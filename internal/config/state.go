@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// StateEntry is the verdict recorded for one finished server.
+type StateEntry struct {
+	Valid       bool
+	FailedCount int
+}
+
+// ResumeState holds the servers finished by a previous run, loaded from
+// a -state file. Each line is "<ip> <valid|invalid> <failed checks>".
+type ResumeState struct {
+	Servers map[string]StateEntry // ip ➜ last recorded verdict
+}
+
+// StateLine formats a state file line for a finished server.
+func StateLine(ip string, valid bool, failedCount int) string {
+	verdict := "invalid"
+	if valid {
+		verdict = "valid"
+	}
+	return fmt.Sprintf("%s %s %d\n", ip, verdict, failedCount)
+}
+
+// LoadState reads a state file. A truncated last line (crash while
+// writing) is ignored.
+func LoadState(path string) (*ResumeState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	defer file.Close()
+
+	state := &ResumeState{Servers: make(map[string]StateEntry)}
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF { // last line is complete only if '\n'-ended
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Can't read %q: %w", path, err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 ||
+			(fields[1] != "valid" && fields[1] != "invalid") {
+			return nil, fmt.Errorf("%v line %v: invalid state entry: %q", path, lineNo, line)
+		}
+		failed, err := strconv.Atoi(fields[2])
+		if err != nil || failed < 0 {
+			return nil, fmt.Errorf("%v line %v: invalid failed count: %q", path, lineNo, fields[2])
+		}
+		state.Servers[fields[0]] = StateEntry{
+			Valid:       fields[1] == "valid",
+			FailedCount: failed,
+		}
+	}
+	return state, nil
+}
+
+// LoadOutput marks the servers of a previous -o file as valid, unless
+// already recorded: they may be missing from the state file if the run
+// crashed right after writing them. A truncated last line is ignored.
+func (rs *ResumeState) LoadOutput(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%q: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF { // last line is complete only if '\n'-ended
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Can't read %q: %w", path, err)
+		}
+		ip := strings.TrimSpace(line)
+		if ip == "" || rs.Done(ip) {
+			continue
+		}
+		rs.Servers[ip] = StateEntry{Valid: true}
+	}
+}
+
+// Counts returns how many servers were valid, invalid, and had at
+// least one failed check.
+func (rs *ResumeState) Counts() (valid, invalid, withFailures int) {
+	for _, entry := range rs.Servers {
+		if entry.Valid {
+			valid++
+		} else {
+			invalid++
+		}
+		if entry.FailedCount > 0 {
+			withFailures++
+		}
+	}
+	return valid, invalid, withFailures
+}
+
+// Done returns true if ip was finished by the previous run.
+func (rs *ResumeState) Done(ip string) bool {
+	_, done := rs.Servers[ip]
+	return done
+}
+
+// Merge adds the servers of other to rs. A server found in both is
+// kept invalid if either verdict is invalid (with the highest failed
+// count); conflicts counts the servers with diverging verdicts.
+func (rs *ResumeState) Merge(other *ResumeState) (conflicts int) {
+	for ip, entry := range other.Servers {
+		prev, found := rs.Servers[ip]
+		if found {
+			if prev.Valid != entry.Valid {
+				conflicts++
+			}
+			entry.Valid = entry.Valid && prev.Valid
+			entry.FailedCount = max(entry.FailedCount, prev.FailedCount)
+		}
+		rs.Servers[ip] = entry
+	}
+	return conflicts
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadState(t *testing.T) {
+	path := createTempFile(t, "# dnsanity state\n"+
+		StateLine("1.1.1.1", true, 0)+
+		StateLine("8.8.8.8", false, 2)+
+		StateLine("9.9.9.9", true, 1)+
+		StateLine("8.8.8.8", true, 0)+ // re-tested: last verdict wins
+		"4.4.4.4 val") // truncated by a crash
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	want := map[string]StateEntry{
+		"1.1.1.1": {Valid: true},
+		"8.8.8.8": {Valid: true},
+		"9.9.9.9": {Valid: true, FailedCount: 1},
+	}
+	if !reflect.DeepEqual(state.Servers, want) {
+		t.Fatalf("got %+v, want %+v", state.Servers, want)
+	}
+	if v, i, f := state.Counts(); v != 3 || i != 0 || f != 1 {
+		t.Fatalf("Counts() = %d,%d,%d, want 3,0,1", v, i, f)
+	}
+	if !state.Done("9.9.9.9") || state.Done("2.2.2.2") {
+		t.Fatal("Done() mismatch")
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	if _, err := LoadState("/nonexistent/state.txt"); err == nil {
+		t.Fatal("expected error on missing file")
+	}
+	for _, content := range []string{
+		"1.1.1.1 maybe 0\n",
+		"1.1.1.1 valid\n",
+		"1.1.1.1 valid -1\n",
+	} {
+		_, err := LoadState(createTempFile(t, content))
+		if err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("LoadState(%q): expected line error, got %v", content, err)
+		}
+	}
+}
+
+func TestMergeState(t *testing.T) {
+	state := &ResumeState{Servers: map[string]StateEntry{
+		"1.1.1.1": {Valid: true},
+		"8.8.8.8": {Valid: true},
+	}}
+	conflicts := state.Merge(&ResumeState{Servers: map[string]StateEntry{
+		"1.1.1.1": {Valid: true, FailedCount: 1},
+		"8.8.8.8": {Valid: false, FailedCount: 2},
+		"9.9.9.9": {Valid: false},
+	}})
+	want := map[string]StateEntry{
+		"1.1.1.1": {Valid: true, FailedCount: 1},
+		"8.8.8.8": {Valid: false, FailedCount: 2}, // invalid wins
+		"9.9.9.9": {Valid: false},
+	}
+	if conflicts != 1 || !reflect.DeepEqual(state.Servers, want) {
+		t.Fatalf("got %+v (%d conflicts), want %+v (1 conflict)",
+			state.Servers, conflicts, want)
+	}
+}
+
+func TestResumeStateLoadOutput(t *testing.T) {
+	state := &ResumeState{Servers: map[string]StateEntry{
+		"8.8.8.8": {Valid: false, FailedCount: 2},
+	}}
+	// 1.1.1.1 written to -o, but crashed before its state line
+	path := createTempFile(t, "8.8.8.8\n1.1.1.1\n\n9.9.9")
+	if err := state.LoadOutput(path); err != nil {
+		t.Fatalf("LoadOutput: %v", err)
+	}
+	want := map[string]StateEntry{
+		"8.8.8.8": {Valid: false, FailedCount: 2}, // state file wins
+		"1.1.1.1": {Valid: true},
+	}
+	if !reflect.DeepEqual(state.Servers, want) {
+		t.Fatalf("got %+v, want %+v", state.Servers, want)
+	}
+	if err := state.LoadOutput("/nonexistent/out.txt"); err == nil {
+		t.Fatal("expected error on missing file")
+	}
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+// --------------------------------------------------------------------
+// Differential mode (answers gathered from trusted servers at run time)
+// --------------------------------------------------------------------
+
+// Equivalence tells whether two A records are considered equivalent.
+type Equivalence func(a, b string) bool
+
+// ExactEquivalence requires both records to be the same address.
+func ExactEquivalence(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// PrefixEquivalence considers two addresses equivalent when they belong
+// to the same /bits4 (IPv4) or /bits6 (IPv6) network.
+func PrefixEquivalence(bits4, bits6 int) Equivalence {
+	return func(a, b string) bool {
+		ipA, errA := netip.ParseAddr(a)
+		ipB, errB := netip.ParseAddr(b)
+		return errA == nil && errB == nil &&
+			netutil.SamePrefix(ipA, ipB, bits4, bits6)
+	}
+}
+
+// ASNEquivalence considers two addresses equivalent when they are
+// announced by the same AS, according to db.
+func ASNEquivalence(db *netutil.ASNDB) Equivalence {
+	return func(a, b string) bool {
+		if ExactEquivalence(a, b) {
+			return true
+		}
+		ipA, errA := netip.ParseAddr(a)
+		ipB, errB := netip.ParseAddr(b)
+		if errA != nil || errB != nil {
+			return false
+		}
+		asnA, okA := db.Lookup(ipA)
+		asnB, okB := db.Lookup(ipB)
+		return okA && okB && asnA == asnB
+	}
+}
+
+// NewDifferentialTemplate builds a template without expected answers:
+// they are learned later from trusted servers with AddLiveAnswer(), then
+// compared using eq.
+func NewDifferentialTemplate(domains []string, eq Equivalence) Template {
+	tpl := make(Template, len(domains))
+	for i, domain := range domains {
+		tpl[i] = TemplateEntry{Domain: domain, Equivalent: eq}
+	}
+	return tpl
+}
+
+// AddLiveAnswer learns a trusted answer for a differential entry.
+// Only deterministic answers (NOERROR / NXDOMAIN) are kept.
+// Returns true if the answer was usable.
+func (te *TemplateEntry) AddLiveAnswer(da *DNSAnswer) bool {
+	if da == nil || da.Domain != te.Domain ||
+		(da.Status != "NOERROR" && da.Status != "NXDOMAIN") {
+		return false
+	}
+	for _, known := range te.ValidAnswers {
+		if known.Status == da.Status &&
+			matchRecords(known.A, da.A) && matchRecords(known.CNAME, da.CNAME) {
+			return true // already known
+		}
+	}
+	te.ValidAnswers = append(te.ValidAnswers, DNSAnswerData{
+		Status: da.Status,
+		A:      append([]string{}, da.A...),
+		CNAME:  append([]string{}, da.CNAME...),
+	})
+	return true
+}
+
+// matchesLive compares da to the union of learned answers sharing its
+// status: each A record must be equivalent to a learned one, and each
+// CNAME must have been seen.
+func (te *TemplateEntry) matchesLive(da *DNSAnswer) bool {
+	var knownA, knownCNAME []string
+	found := false
+	for _, known := range te.ValidAnswers {
+		if known.Status == da.Status {
+			found = true
+			knownA = append(knownA, known.A...)
+			knownCNAME = append(knownCNAME, known.CNAME...)
+		}
+	}
+	if !found || (len(knownA) == 0) != (len(da.A) == 0) {
+		return false
+	}
+	return allEquivalent(da.A, knownA, te.Equivalent) &&
+		allEquivalent(da.CNAME, knownCNAME, ExactEquivalence)
+}
+
+// allEquivalent returns true if each value is equivalent to a known one.
+func allEquivalent(values, known []string, eq Equivalence) bool {
+	for _, value := range values {
+		ok := false
+		for _, k := range known {
+			if eq(value, k) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
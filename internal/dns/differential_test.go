@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+// answer builds a DNSAnswer for tests.
+func answer(domain, status string, a ...string) *DNSAnswer {
+	return &DNSAnswer{Domain: domain, DNSAnswerData: DNSAnswerData{Status: status, A: a}}
+}
+
+// TestAddLiveAnswer checks learned answers filtering and deduplication.
+func TestAddLiveAnswer(t *testing.T) {
+	tpl := NewDifferentialTemplate([]string{"geo.example"}, ExactEquivalence)
+	te := &tpl[0]
+	if te.Matches(answer("geo.example", "NOERROR", "192.0.2.1")) {
+		t.Fatal("entry without learned answers must never match")
+	}
+	if te.AddLiveAnswer(answer("geo.example", "TIMEOUT")) {
+		t.Error("TIMEOUT must not be learned")
+	}
+	if te.AddLiveAnswer(answer("other.example", "NOERROR", "192.0.2.1")) {
+		t.Error("answer for another domain must not be learned")
+	}
+	te.AddLiveAnswer(answer("geo.example", "NOERROR", "192.0.2.1"))
+	te.AddLiveAnswer(answer("geo.example", "NOERROR", "192.0.2.1"))
+	te.AddLiveAnswer(answer("geo.example", "NOERROR", "198.51.100.7"))
+	if len(te.ValidAnswers) != 2 {
+		t.Fatalf("expected 2 learned answers, got %d", len(te.ValidAnswers))
+	}
+}
+
+// TestDifferentialMatches covers each equivalence against learned answers.
+func TestDifferentialMatches(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "asn.db")
+	os.WriteFile(dbPath, []byte("192.0.2.0/24 64500\n203.0.113.0/24 64500\n198.51.100.0/24 64501\n"), 0644)
+	db, err := netutil.LoadASNDB(dbPath)
+	if err != nil {
+		t.Fatalf("LoadASNDB: %v", err)
+	}
+	cases := []struct {
+		name string
+		eq   Equivalence
+		ans  *DNSAnswer
+		want bool
+	}{
+		{"exact ok", ExactEquivalence, answer("geo.example", "NOERROR", "192.0.2.1"), true},
+		{"exact union", ExactEquivalence, answer("geo.example", "NOERROR", "192.0.2.1", "2001:db8::1"), true},
+		{"exact ko", ExactEquivalence, answer("geo.example", "NOERROR", "192.0.2.2"), false},
+		{"prefix ok", PrefixEquivalence(24, 48), answer("geo.example", "NOERROR", "192.0.2.200"), true},
+		{"prefix v6 ok", PrefixEquivalence(24, 48), answer("geo.example", "NOERROR", "2001:db8:0:1::9"), true},
+		{"prefix ko", PrefixEquivalence(24, 48), answer("geo.example", "NOERROR", "192.0.3.1"), false},
+		{"asn ok", ASNEquivalence(db), answer("geo.example", "NOERROR", "203.0.113.9"), true},
+		{"asn ko", ASNEquivalence(db), answer("geo.example", "NOERROR", "198.51.100.1"), false},
+		{"asn unknown", ASNEquivalence(db), answer("geo.example", "NOERROR", "10.0.0.1"), false},
+		{"empty answer", PrefixEquivalence(24, 48), answer("geo.example", "NOERROR"), false},
+		{"wrong status", PrefixEquivalence(24, 48), answer("geo.example", "NXDOMAIN"), false},
+		{"hijacked", PrefixEquivalence(24, 48), answer("geo.example", "NOERROR", "192.0.2.1", "10.0.0.1"), false},
+	}
+	for _, c := range cases {
+		tpl := NewDifferentialTemplate([]string{"geo.example"}, c.eq)
+		tpl[0].AddLiveAnswer(answer("geo.example", "NOERROR", "192.0.2.1"))
+		tpl[0].AddLiveAnswer(answer("geo.example", "NOERROR", "2001:db8::1"))
+		if got := tpl[0].Matches(c.ans); got != c.want {
+			t.Errorf("%s: Matches() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestDifferentialMatches_NXDOMAINAndCNAME covers record-less answers
+// and CNAME comparison.
+func TestDifferentialMatches_NXDOMAINAndCNAME(t *testing.T) {
+	tpl := NewDifferentialTemplate([]string{"a.example", "b.example"}, PrefixEquivalence(24, 48))
+	tpl[0].AddLiveAnswer(answer("a.example", "NXDOMAIN"))
+	if !tpl[0].Matches(answer("a.example", "NXDOMAIN")) {
+		t.Error("NXDOMAIN should match learned NXDOMAIN")
+	}
+	if tpl[0].Matches(answer("a.example", "NOERROR", "192.0.2.1")) {
+		t.Error("redirected NXDOMAIN must not match")
+	}
+	cname := answer("b.example", "NOERROR", "192.0.2.1")
+	cname.CNAME = []string{"cdn.example."}
+	tpl[1].AddLiveAnswer(cname)
+	ok := answer("b.example", "NOERROR", "192.0.2.7")
+	ok.CNAME = []string{"CDN.example."}
+	if !tpl[1].Matches(ok) {
+		t.Error("same CNAME and /24 should match")
+	}
+	ko := answer("b.example", "NOERROR", "192.0.2.7")
+	ko.CNAME = []string{"evil.example."}
+	if tpl[1].Matches(ko) {
+		t.Error("unknown CNAME must not match")
+	}
+}
@@ -3,6 +3,8 @@ package dns
 import (
 	"fmt"
 	"strings"
+
+	"codeberg.org/miekg/dns"
 )
 
 // --------------------------------------------------------------------
@@ -90,6 +92,16 @@ func (da *DNSAnswer) ToString() string {
 	return out
 }
 
+// IsResponse returns true if the server answered (with any rcode), as
+// opposed to TIMEOUT, network or local errors.
+func (da *DNSAnswer) IsResponse() bool {
+	if da == nil {
+		return false
+	}
+	_, ok := dns.StringToRcode[da.Status]
+	return ok
+}
+
 // IsWorthRetrying returns true if the answer is eligible for a retry.
 // Criteria:
 // - Transient DNS errors: TIMEOUT or SERVFAIL
@@ -131,3 +131,28 @@ func TestDNSAnswer_ToString(t *testing.T) {
 		t.Fatalf("ToString() (truncated) = %q, want %q", got, want)
 	}
 }
+
+// TestDNSAnswer_IsResponse checks that any rcode is a response, unlike
+// timeouts and errors.
+func TestDNSAnswer_IsResponse(t *testing.T) {
+	t.Parallel()
+
+	for status, want := range map[string]bool{
+		"NOERROR":          true,
+		"NXDOMAIN":         true,
+		"SERVFAIL":         true,
+		"REFUSED":          true,
+		"TIMEOUT":          false,
+		"ECONNREFUSED":     false,
+		"ERROR - canceled": false,
+		"SKIPPED":          false,
+	} {
+		da := &DNSAnswer{DNSAnswerData: DNSAnswerData{Status: status}}
+		if got := da.IsResponse(); got != want {
+			t.Errorf("IsResponse() for %s = %v, want %v", status, got, want)
+		}
+	}
+	if (*DNSAnswer)(nil).IsResponse() {
+		t.Errorf("IsResponse() on nil should be false")
+	}
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EntryVotes tells how the trusted servers voted for a template entry.
+type EntryVotes struct {
+	Entry  *TemplateEntry
+	Passed int                   // servers which validated the entry
+	Failed map[string]*DNSAnswer // failing servers, and their last answer
+}
+
+// ToString describes a failing entry (prefixed by its position), e.g.
+// "a.com A=1.2.3.4 (1/3 passed) - failed on 8.8.8.8 (TIMEOUT), ...".
+func (ev *EntryVotes) ToString() string {
+	ips := make([]string, 0, len(ev.Failed))
+	for ip := range ev.Failed {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	fails := make([]string, len(ips))
+	for i, ip := range ips {
+		fails[i] = fmt.Sprintf(
+			"%s (%s)", ip, ev.Failed[ip].DNSAnswerData.ToString())
+	}
+	out := fmt.Sprintf("%s (%d/%d passed) - failed on %s",
+		ev.Entry.ToString(), ev.Passed, ev.Passed+len(ev.Failed),
+		strings.Join(fails, ", "))
+	if pos := ev.Entry.Position(); pos != "" {
+		out = pos + ": " + out
+	}
+	return out
+}
+
+// TrustedVotes counts, for each template entry, the finished trusted
+// servers which validated it. It returns the entries validated by less
+// than quorum servers, and the ones which failed on some servers but
+// still reached the quorum (in template order).
+func TrustedVotes(
+	tpl Template,
+	servers []*ServerContext,
+	quorum int,
+) (failed, partial []*EntryVotes) {
+	for i := range tpl {
+		ev := &EntryVotes{Entry: &tpl[i], Failed: make(map[string]*DNSAnswer)}
+		for _, srv := range servers {
+			if srv.Checks[i].Passed {
+				ev.Passed++
+			} else {
+				ev.Failed[srv.IPAddress] = srv.Checks[i].Answer
+			}
+		}
+		if ev.Passed < quorum {
+			failed = append(failed, ev)
+		} else if len(ev.Failed) > 0 {
+			partial = append(partial, ev)
+		}
+	}
+	return failed, partial
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"testing"
+)
+
+// votingServer returns a finished server, whose check i passed if
+// verdicts[i] is '+' (or failed with status TIMEOUT).
+func votingServer(ip string, tpl Template, verdicts string) *ServerContext {
+	srv := NewServerContext(ip, tpl, 1)
+	for i := range tpl {
+		srv.Checks[i].Passed = verdicts[i] == '+'
+		if !srv.Checks[i].Passed {
+			srv.Checks[i].Answer.Status = "TIMEOUT"
+		}
+	}
+	return srv
+}
+
+func TestTrustedVotes(t *testing.T) {
+	tpl := buildTemplate([]string{"a.example", "b.example", "c.example"})
+	servers := []*ServerContext{
+		votingServer("9.9.9.9", tpl, "++-"),
+		votingServer("1.1.1.1", tpl, "+--"),
+		votingServer("8.8.8.8", tpl, "+++"),
+	}
+
+	// all servers must agree
+	failed, partial := TrustedVotes(tpl, servers, len(servers))
+	if len(failed) != 2 || len(partial) != 0 {
+		t.Fatalf("quorum 3: got %d failed, %d partial", len(failed), len(partial))
+	}
+	if failed[0].Entry.Domain != "b.example" || failed[0].Passed != 2 {
+		t.Errorf("quorum 3: unexpected 1st failure %+v", failed[0])
+	}
+	want := "c.example NOERROR (1/3 passed) - " +
+		"failed on 1.1.1.1 (TIMEOUT), 9.9.9.9 (TIMEOUT)"
+	if got := failed[1].ToString(); got != want {
+		t.Errorf("ToString():\n got %q\nwant %q", got, want)
+	}
+
+	// 2 of 3 servers
+	failed, partial = TrustedVotes(tpl, servers, 2)
+	if len(failed) != 1 || failed[0].Entry.Domain != "c.example" {
+		t.Errorf("quorum 2: unexpected failures %v", failed)
+	}
+	if len(partial) != 1 || partial[0].Entry.Domain != "b.example" {
+		t.Errorf("quorum 2: unexpected partial failures %v", partial)
+	}
+
+	// position prefix
+	tpl[2].File, tpl[2].Line = "tpl.txt", 7
+	failed, _ = TrustedVotes(tpl, servers, 2)
+	if got := failed[0].ToString(); got[:10] != "tpl.txt:7:" {
+		t.Errorf("expected position prefix, got %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/netip"
 	"syscall"
 	"time"
 
@@ -14,6 +15,40 @@ import (
 
 var dnsServerPort = "53"
 
+// Resolver sends a DNS query (A record of domain) to dnsServer.
+// Implementations (other transports, caching, fakes...) must be safe for
+// concurrent use, and return early once ctx is done.
+type Resolver interface {
+	Resolve(
+		domain string,
+		dnsServer string,
+		timeout time.Duration,
+		ctx context.Context,
+	) *DNSAnswer
+}
+
+// ResolverFunc adapts a function to the Resolver interface.
+type ResolverFunc func(
+	domain string,
+	dnsServer string,
+	timeout time.Duration,
+	ctx context.Context,
+) *DNSAnswer
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(
+	domain string,
+	dnsServer string,
+	timeout time.Duration,
+	ctx context.Context,
+) *DNSAnswer {
+	return f(domain, dnsServer, timeout, ctx)
+}
+
+// UDPResolver is the default Resolver: queries over UDP with ResolveDNS().
+var UDPResolver Resolver = ResolverFunc(ResolveDNS)
+
+// ResolveDNS queries dnsServer (UDP port 53) for the A record of domain.
 func ResolveDNS(
 	domain string,
 	dnsServer string,
@@ -21,7 +56,10 @@ func ResolveDNS(
 	ctx context.Context,
 ) *DNSAnswer {
 	transport := dns.NewTransport()
-	transport.Dialer.Timeout = timeout
+	// NewTransport() shares its *net.Dialer: copy it before changing it
+	dialer := *transport.Dialer
+	dialer.Timeout = timeout
+	transport.Dialer = &dialer
 	transport.ReadTimeout = timeout
 	transport.WriteTimeout = timeout
 	client := &dns.Client{Transport: transport}
@@ -34,7 +72,10 @@ func ResolveDNS(
 
 	// DNS resolution
 	// net.JoinHostPort() is needed for ipv6 (bracket expansion):
-	hostAndPort := net.JoinHostPort(dnsServer, dnsServerPort)
+	hostAndPort := dnsServer
+	if _, err := netip.ParseAddrPort(dnsServer); err != nil { // no port
+		hostAndPort = net.JoinHostPort(dnsServer, dnsServerPort)
+	}
 	response, _, err := client.Exchange(ctx, message, "udp", hostAndPort)
 	if err != nil {
 		answer.Status = mapResolveError(err)
@@ -57,6 +98,22 @@ func ResolveDNS(
 	return answer
 }
 
+// IsKnownStatus tells whether UDPResolver can answer status: an rcode
+// (e.g. NXDOMAIN), TIMEOUT, or an errno name (e.g. ECONNREFUSED).
+func IsKnownStatus(status string) bool {
+	if status == "" {
+		return false
+	} else if _, ok := dns.StringToRcode[status]; ok || status == "TIMEOUT" {
+		return true
+	}
+	for errno := syscall.Errno(1); errno < 256; errno++ {
+		if unix.ErrnoName(errno) == status {
+			return true
+		}
+	}
+	return false
+}
+
 func mapResolveError(err error) string {
 	if err == nil {
 		return ""
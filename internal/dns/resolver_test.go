@@ -214,3 +214,25 @@ func TestMapResolveError(t *testing.T) {
 		})
 	}
 }
+
+func TestIsKnownStatus(t *testing.T) {
+	t.Parallel()
+
+	for status, want := range map[string]bool{
+		"NOERROR":      true,
+		"NXDOMAIN":     true,
+		"SERVFAIL":     true,
+		"REFUSED":      true,
+		"TIMEOUT":      true,
+		"ECONNREFUSED": true,
+		"EHOSTUNREACH": true,
+		"SRVFAIL":      false,
+		"TC":           false, // (set by the scheduler, not the resolver)
+		"nxdomain":     false,
+		"":             false,
+	} {
+		if got := IsKnownStatus(status); got != want {
+			t.Errorf("IsKnownStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"math"
+	"time"
+)
+
+// scoreLatencyRef is the query latency costing a passed check 1/8 of its
+// score (the slower the server, the closer to 1/4).
+const scoreLatencyRef = 250 * time.Millisecond
+
+// score returns the reliability of a check, between -1 and 1: a check
+// passed at 1st attempt scores up to 1 (less if slow), divided by the
+// attempts it took. A failed check scores 0 if the server didn't answer
+// (TIMEOUT...), or -1 for a wrong answer. Checks never run score 0.
+func (chk *CheckContext) score() float64 {
+	attempts := chk.MaxAttempts - chk.AttemptsLeft
+	switch {
+	case attempts <= 0 || chk.Answer == nil:
+		return 0
+	case !chk.Passed && !chk.Answer.IsResponse():
+		return 0
+	case !chk.Passed:
+		return -1
+	}
+	latency := chk.Elapsed / time.Duration(attempts)
+	speed := float64(scoreLatencyRef) / float64(scoreLatencyRef+latency)
+	return (0.75 + 0.25*speed) / float64(attempts)
+}
+
+// Score rates the reliability of a finished server from 0 to 100: the
+// weighted mean of its checks scores (see CheckContext.score), rounded
+// to 1 decimal.
+func (srv *ServerContext) Score() float64 {
+	total, weights := 0.0, 0.0
+	for i := range srv.Checks {
+		weight := srv.Checks[i].Weight
+		if weight == 0 { // built without template weights
+			weight = 1
+		}
+		total += weight * srv.Checks[i].score()
+		weights += weight
+	}
+	if weights == 0 || total <= 0 {
+		return 0
+	}
+	return math.Round(1000*total/weights) / 10
+}
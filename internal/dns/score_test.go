@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerContextScore(t *testing.T) {
+	tpl, _ := NewTemplate("a.com NXDOMAIN\nb.com NXDOMAIN weight=3")
+	// check sets the result of check i, after attempts of latency each.
+	check := func(srv *ServerContext, i int, passed bool, status string,
+		attempts int, latency time.Duration) {
+		chk := &srv.Checks[i]
+		chk.Passed = passed
+		chk.Answer.Status = status
+		chk.AttemptsLeft = chk.MaxAttempts - attempts
+		chk.Elapsed = time.Duration(attempts) * latency
+	}
+
+	cases := []struct {
+		name  string
+		setup func(srv *ServerContext)
+		score float64
+	}{
+		{"perfect", func(srv *ServerContext) {
+			check(srv, 0, true, "NXDOMAIN", 1, 0)
+			check(srv, 1, true, "NXDOMAIN", 1, 0)
+		}, 100},
+		{"slow", func(srv *ServerContext) { // 0.875 per check
+			check(srv, 0, true, "NXDOMAIN", 1, scoreLatencyRef)
+			check(srv, 1, true, "NXDOMAIN", 1, scoreLatencyRef)
+		}, 87.5},
+		{"retried_heavy_check", func(srv *ServerContext) { // (1 + 3*0.5)/4
+			check(srv, 0, true, "NXDOMAIN", 1, 0)
+			check(srv, 1, true, "NXDOMAIN", 2, 0)
+		}, 62.5},
+		{"timeout", func(srv *ServerContext) { // (1 + 3*0)/4
+			check(srv, 0, true, "NXDOMAIN", 1, 0)
+			check(srv, 1, false, "TIMEOUT", 3, time.Second)
+		}, 25},
+		{"wrong_answer", func(srv *ServerContext) { // (3 - 1)/4
+			check(srv, 0, false, "NOERROR", 1, 0)
+			check(srv, 1, true, "NXDOMAIN", 1, 0)
+		}, 50},
+		{"lying", func(srv *ServerContext) { // negative: clamped
+			check(srv, 1, false, "NOERROR", 1, 0)
+		}, 0},
+		{"never_run", func(srv *ServerContext) {}, 0},
+	}
+	for _, tc := range cases {
+		srv := NewServerContext("192.0.2.1", tpl, 3)
+		tc.setup(srv)
+		if got := srv.Score(); got != tc.score {
+			t.Errorf("%s: Score() = %v, want %v", tc.name, got, tc.score)
+		}
+	}
+}
@@ -7,10 +7,12 @@ import (
 )
 
 type CheckContext struct {
-	Answer       *DNSAnswer // last received answer
-	Passed       bool       // last attempt result
-	AttemptsLeft int        // retries remaining
-	MaxAttempts  int        // immutable upper bound
+	Answer       *DNSAnswer    // last received answer
+	Passed       bool          // last attempt result
+	AttemptsLeft int           // retries remaining
+	MaxAttempts  int           // immutable upper bound
+	Elapsed      time.Duration // time spent in queries (all attempts)
+	Weight       float64       // weight of the check in Score()
 }
 
 type ServerContext struct {
@@ -22,6 +24,9 @@ type ServerContext struct {
 	FailedCount    int            // failed checks.
 	CompletedCount int            // finished checks (pass+fail)
 	NextQueryAt    time.Time      // honour per-server rps
+	RateLimit      float64        // max req/s (0: unlimited)
+	AdaptiveRate   bool           // RateLimit is learned at run time
+	AnsweredCount  int            // queries answered (not TIMEOUT/REFUSED)
 	PendingChecks  []int          // queue of remaining check indexes
 	Checks         []CheckContext // answers log
 }
@@ -43,6 +48,7 @@ func NewServerContext(
 		sc.PendingChecks[i] = i
 		sc.Checks[i].AttemptsLeft = maxAttempts
 		sc.Checks[i].MaxAttempts = maxAttempts
+		sc.Checks[i].Weight = template[i].ScoreWeight()
 		sc.Checks[i].Answer = &DNSAnswer{
 			Domain:        template[i].Domain,
 			DNSAnswerData: DNSAnswerData{Status: "SKIPPED"},
@@ -51,6 +57,14 @@ func NewServerContext(
 	return sc
 }
 
+// ReqInterval returns the minimum delay between two queries.
+func (srv *ServerContext) ReqInterval() time.Duration {
+	if srv.RateLimit <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / srv.RateLimit)
+}
+
 // Finished returns true when the server is either disabled or has
 // completed all its checks.
 // ServerContext.Finished():
@@ -60,12 +74,22 @@ func (srv *ServerContext) Finished() bool {
 
 func (srv *ServerContext) PrettyDump() string {
 	var s string
-	if srv.FailedCount == 0 {
+	rateRepr := ""
+	if srv.AdaptiveRate {
+		rateRepr = fmt.Sprintf(", %.2f req/s", srv.RateLimit)
+	}
+	if !srv.Disabled {
+		s += fmt.Sprintf(
+			"\033[1;32m[+] SERVER %v (valid%s)\033[m - score %.1f\n",
+			srv.IPAddress, rateRepr, srv.Score())
+	} else if srv.FailedCount == 0 { // dropped by -min-score
 		s += fmt.Sprintf(
-			"\033[1;32m[+] SERVER %v (valid)\033[m\n", srv.IPAddress)
+			"\033[1;31m[-] SERVER %v (invalid, score too low%s)\033[m - score %.1f\n",
+			srv.IPAddress, rateRepr, srv.Score())
 	} else {
 		s += fmt.Sprintf(
-			"\033[1;31m[-] SERVER %v (invalid)\033[m\n", srv.IPAddress)
+			"\033[1;31m[-] SERVER %v (invalid%s)\033[m - score %.1f\n",
+			srv.IPAddress, rateRepr, srv.Score())
 	}
 	for _, test := range srv.Checks {
 		var prefix string
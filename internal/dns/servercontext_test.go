@@ -132,6 +132,7 @@ func TestPrettyDumpExhaustive(t *testing.T) {
 
 	// Mark completed to exercise header logic.
 	sc.CompletedCount = len(sc.Checks)
+	sc.Disabled = true
 
 	gotDump := stripANSIFast(sc.PrettyDump())
 
@@ -139,8 +140,8 @@ func TestPrettyDumpExhaustive(t *testing.T) {
 	if !strings.Contains(gotDump, "SERVER 8.8.4.4") {
 		t.Fatalf("PrettyDump header missing IP: %s", gotDump)
 	}
-	if !strings.Contains(gotDump, "(invalid)") {
-		t.Fatalf("PrettyDump should mark server invalid when FailedCount>0: %s", gotDump)
+	if !strings.Contains(gotDump, "[-] SERVER 8.8.4.4 (invalid)") {
+		t.Fatalf("PrettyDump should mark disabled server invalid: %s", gotDump)
 	}
 
 	// Prefix markers.
@@ -168,3 +169,24 @@ func TestPrettyDumpExhaustive(t *testing.T) {
 	_ = sc.PrettyDump()
 	deadline.Stop()
 }
+
+// TestReqIntervalAndAdaptiveDump checks the interval derived from
+// RateLimit, and that a learned rate shows up in PrettyDump().
+func TestReqIntervalAndAdaptiveDump(t *testing.T) {
+	sc := NewServerContext("1.2.3.4", buildTemplate([]string{"a.example"}), 1)
+	if got := sc.ReqInterval(); got != 0 {
+		t.Fatalf("unlimited rate: interval=%v, want 0", got)
+	}
+	sc.RateLimit = 4
+	if got := sc.ReqInterval(); got != 250*time.Millisecond {
+		t.Fatalf("4 req/s: interval=%v, want 250ms", got)
+	}
+	if dump := stripANSIFast(sc.PrettyDump()); strings.Contains(dump, "req/s") {
+		t.Fatalf("fixed rate must not be dumped: %s", dump)
+	}
+	sc.AdaptiveRate = true
+	sc.RateLimit = 1.5
+	if dump := stripANSIFast(sc.PrettyDump()); !strings.Contains(dump, "(valid, 1.50 req/s)") {
+		t.Fatalf("learned rate missing from dump: %s", dump)
+	}
+}
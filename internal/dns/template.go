@@ -2,10 +2,12 @@ package dns
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +17,15 @@ import (
 type TemplateEntry struct {
 	Domain       string
 	ValidAnswers []DNSAnswerData
+	Tags         []string // optional category labels ([tag] tokens)
+	Weight       float64  // weight in server scores (weight=N, 0: default)
+	File         string   // source file ("" if loaded from a string)
+	Line         int      // source line number (0 if unknown)
+	// Equivalent, if set, marks a differential entry: ValidAnswers are
+	// learned at run time, and A records are compared with it.
+	Equivalent Equivalence
+	// Probe, if set, accepts any DNS response (liveness check).
+	Probe bool
 }
 
 // NewTemplateEntry() creates a new TemplateEntry from string
@@ -25,12 +36,40 @@ func NewTemplateEntry(line string) (*TemplateEntry, error) {
 		return nil, fmt.Errorf("must have a domain and at least one A|CNAME record or NXDOMAIN/NOERROR")
 	}
 	domain := parts[0]
-	remainder := line[len(domain):]
+	remainder := strings.TrimSpace(line[len(domain):])
 
 	// 2) Build entry holder.
 	te := &TemplateEntry{Domain: domain}
 
-	// 3) For each alternative separated by "||", build a DNSAnswerData.
+	// 3) Strip trailing [tag] labels (e.g. "[censorship,nx] [cdn]").
+	for {
+		start := strings.LastIndex(remainder, "[")
+		if start == -1 || !strings.HasSuffix(remainder, "]") {
+			break
+		}
+		tags, err := parseTags(remainder[start+1 : len(remainder)-1])
+		if err != nil {
+			return nil, err
+		}
+		te.Tags = append(tags, te.Tags...)
+		remainder = strings.TrimSpace(remainder[:start])
+	}
+	// 4) Strip trailing weight=N token.
+	if idx := strings.LastIndexAny(remainder, " \t"); idx != -1 &&
+		strings.HasPrefix(remainder[idx+1:], "weight=") {
+		weight, err := strconv.ParseFloat(
+			strings.TrimPrefix(remainder[idx+1:], "weight="), 64)
+		if err != nil || !(weight > 0) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("invalid weight: %q (must be > 0)", remainder[idx+1:])
+		}
+		te.Weight = weight
+		remainder = strings.TrimSpace(remainder[:idx])
+	}
+	if remainder == "" {
+		return nil, fmt.Errorf("must have a domain and at least one A|CNAME record or NXDOMAIN/NOERROR")
+	}
+
+	// 5) For each alternative separated by "||", build a DNSAnswerData.
 	for _, alt := range strings.Split(remainder, "||") {
 		answer, err := NewDNSAnswerData(strings.TrimSpace(alt))
 		if err != nil {
@@ -41,17 +80,79 @@ func NewTemplateEntry(line string) (*TemplateEntry, error) {
 	return te, nil
 }
 
+// Position returns the entry location as "file:line", "line N" or "".
+func (te *TemplateEntry) Position() string {
+	switch {
+	case te.Line == 0:
+		return ""
+	case te.File == "":
+		return fmt.Sprintf("line %d", te.Line)
+	default:
+		return fmt.Sprintf("%s:%d", te.File, te.Line)
+	}
+}
+
 func (te *TemplateEntry) ToString() string {
+	if te.Probe {
+		return te.Domain + " <any response>"
+	}
 	altList := []string{}
 	for _, dad := range te.ValidAnswers {
 		altList = append(altList, dad.ToString())
 	}
-	return te.Domain + " " + strings.Join(altList, " || ")
+	out := te.Domain + " " + strings.Join(altList, " || ")
+	if te.Weight != 0 && te.Weight != 1 {
+		out += " weight=" + strconv.FormatFloat(te.Weight, 'g', -1, 64)
+	}
+	if len(te.Tags) > 0 {
+		out += " [" + strings.Join(te.Tags, ",") + "]"
+	}
+	return out
+}
+
+// ScoreWeight returns the weight of the entry in server scores (1 by
+// default).
+func (te *TemplateEntry) ScoreWeight() float64 {
+	if te.Weight == 0 {
+		return 1
+	}
+	return te.Weight
+}
+
+// HasAnyTag returns true if the entry carries at least one of tags.
+func (te *TemplateEntry) HasAnyTag(tags []string) bool {
+	for _, want := range tags {
+		for _, tag := range te.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseTags splits the content of a "[...]" label into tag names.
+func parseTags(s string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.ContainsAny(tag, " \t[]") {
+			return nil, fmt.Errorf("invalid tag label: %q", "["+s+"]")
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
 }
 
 // TemplateEntry.Matches() compares itself to a DNSAnswer
 func (te *TemplateEntry) Matches(da *DNSAnswer) bool {
 	if te != nil && da != nil && te.Domain == da.Domain {
+		if te.Probe {
+			return da.IsResponse()
+		}
+		if te.Equivalent != nil {
+			return te.matchesLive(da)
+		}
 		for _, choice := range te.ValidAnswers {
 			if choice.Status == da.Status &&
 				matchRecords(choice.A, da.A) &&
@@ -213,52 +314,119 @@ func (t Template) PrettyDump() string {
 	return out
 }
 
-var errNoEntries = errors.New("no entries found")
+// FilterTags returns the entries carrying at least one of tags.
+func (t Template) FilterTags(tags []string) Template {
+	var out Template
+	for _, entry := range t {
+		if entry.HasAnyTag(tags) {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// NewProbeTemplate builds a single-entry template, which only checks
+// that servers answer a query for domain (whatever the answer).
+func NewProbeTemplate(domain string) Template {
+	return Template{{Domain: domain, Probe: true}}
+}
 
 // load a template ([]DNSAnswer) from file.
 func NewTemplateFromFile(filePath string) (Template, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("%q: %w", filePath, err)
-	}
-	defer file.Close()
+	return NewTemplateFromFiles(filePath)
+}
 
-	tpl, err := loadTemplate(
-		file,
-		func(err error, lineNo int) error {
-			return fmt.Errorf("%v line %v: %w", filePath, lineNo, err)
-		},
-	)
-	if err != nil {
-		if err == errNoEntries {
-			return nil, fmt.Errorf("Can't find any entry")
+// load a template ([]DNSAnswer) from several files, concatenated in order.
+func NewTemplateFromFiles(filePaths ...string) (Template, error) {
+	var tpl Template
+	for _, filePath := range filePaths {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", filePath, err)
+		}
+		loader := &templateLoader{}
+		entries, err := loader.loadOpenedFile(file, filePath)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Can't read %q: %w", filePath, err)
 		}
-		return nil, fmt.Errorf("Can't read %q: %w", filePath, err)
+		tpl = append(tpl, entries...)
+	}
+	if len(tpl) == 0 {
+		return nil, fmt.Errorf("Can't find any entry")
 	}
 	return tpl, nil
 }
 
 // load a template ([]DNSAnswer) from a multiline string.
+// @include paths are resolved relative to the current directory.
 func NewTemplate(content string) (Template, error) {
-	tpl, err := loadTemplate(
-		strings.NewReader(content),
+	loader := &templateLoader{}
+	tpl, err := loader.load(
+		strings.NewReader(content), "", ".",
 		func(err error, lineNo int) error {
 			return fmt.Errorf("line %v: %w", lineNo, err)
 		},
 	)
 	if err != nil {
-		if err == errNoEntries {
-			return nil, fmt.Errorf("Can't find any entry")
-		}
 		return nil, fmt.Errorf("Error reading input: %w", err)
+	} else if len(tpl) == 0 {
+		return nil, fmt.Errorf("Can't find any entry")
 	}
 	return tpl, nil
 }
 
-// loadTemplate reads template entries from a reader,
-// using wrapErr to format line-specific errors
-func loadTemplate(
+// templateLoader reads template entries and follows @include directives.
+// It keeps the chain of files being loaded to detect include cycles.
+type templateLoader struct {
+	stack []string // absolute paths of files currently being loaded
+}
+
+// loadFile opens an included file and reads its entries.
+func (tl *templateLoader) loadFile(filePath string) (Template, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", filePath, err)
+	}
+	defer file.Close()
+	return tl.loadOpenedFile(file, filePath)
+}
+
+// loadOpenedFile reads entries from an opened file, wrapping line-specific
+// errors with the file name so that they point at the right file.
+func (tl *templateLoader) loadOpenedFile(
+	file *os.File,
+	filePath string,
+) (Template, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", filePath, err)
+	}
+	for _, loading := range tl.stack {
+		if loading == absPath {
+			chain := append(append([]string{}, tl.stack...), absPath)
+			return nil, fmt.Errorf(
+				"@include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	tl.stack = append(tl.stack, absPath)
+	defer func() { tl.stack = tl.stack[:len(tl.stack)-1] }()
+
+	return tl.load(
+		file, filePath, filepath.Dir(filePath),
+		func(err error, lineNo int) error {
+			return fmt.Errorf("%v line %v: %w", filePath, lineNo, err)
+		},
+	)
+}
+
+// load reads template entries from a reader, using wrapErr to format
+// line-specific errors. Entries are tagged with fileName and their line
+// number; relative @include paths are resolved from baseDir.
+func (tl *templateLoader) load(
 	r io.Reader,
+	fileName string,
+	baseDir string,
 	wrapErr func(error, int) error,
 ) (Template, error) {
 	var tpl Template
@@ -273,17 +441,35 @@ func loadTemplate(
 		if line == "" {
 			continue
 		}
+		// @include directive
+		if fields := strings.Fields(line); fields[0] == "@include" {
+			if len(fields) != 2 {
+				return nil, wrapErr(
+					fmt.Errorf("@include: expects exactly one file path"),
+					lineNoCurrent,
+				)
+			}
+			path := fields[1]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			entries, err := tl.loadFile(path)
+			if err != nil {
+				return nil, wrapErr(err, lineNoCurrent)
+			}
+			tpl = append(tpl, entries...)
+			continue
+		}
 		// Convert to DNSAnswer
 		entry, err := NewTemplateEntry(line)
 		if err != nil {
 			return nil, wrapErr(err, lineNoCurrent)
 		}
+		entry.File, entry.Line = fileName, lineNoCurrent
 		tpl = append(tpl, *entry)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
-	} else if len(tpl) == 0 {
-		return nil, errNoEntries
 	}
 	return tpl, nil
 }
@@ -155,6 +155,22 @@ func TestTemplateEntry_Matches(t *testing.T) {
 	}
 }
 
+// TestTemplateEntry_MatchesProbe checks that a probe accepts any response.
+func TestTemplateEntry_MatchesProbe(t *testing.T) {
+	probe := &NewProbeTemplate(".")[0]
+	for status, want := range map[string]bool{
+		"NOERROR": true, "REFUSED": true, "TIMEOUT": false, "ECONNREFUSED": false,
+	} {
+		ans := &DNSAnswer{Domain: ".", DNSAnswerData: DNSAnswerData{Status: status}}
+		if got := probe.Matches(ans); got != want {
+			t.Errorf("probe.Matches(%s) = %v, want %v", status, got, want)
+		}
+	}
+	if got := probe.ToString(); got != ". <any response>" {
+		t.Errorf("probe.ToString() = %q", got)
+	}
+}
+
 // TestLoadTemplate_StringInput hits the happy path and PrettyDump().
 func TestLoadTemplate_StringInput(t *testing.T) {
 	tmpl := `
@@ -317,3 +333,142 @@ func TestNewTemplateFromFile_ValidComplex(t *testing.T) {
 		t.Errorf("third entry expected 2 alternatives, got %d", l)
 	}
 }
+
+// TestNewTemplateEntry_Tags checks [tag] labels parsing and round-trip.
+func TestNewTemplateEntry_Tags(t *testing.T) {
+	te, err := NewTemplateEntry("sci-hub.ru A=190.115.31.218 || NXDOMAIN [censorship,nx] [geo]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(te.Tags, []string{"censorship", "nx", "geo"}) {
+		t.Fatalf("wrong tags: %q", te.Tags)
+	}
+	if len(te.ValidAnswers) != 2 {
+		t.Fatalf("expected 2 alternatives, got %d", len(te.ValidAnswers))
+	}
+	rebuilt, err := NewTemplateEntry(te.ToString())
+	if err != nil {
+		t.Fatalf("round‑trip failed: %v", err)
+	}
+	if !reflect.DeepEqual(te, rebuilt) {
+		t.Errorf("round‑trip mismatch: %+v vs %+v", te, rebuilt)
+	}
+	if !te.HasAnyTag([]string{"cdn", "geo"}) || te.HasAnyTag([]string{"cdn"}) {
+		t.Error("HasAnyTag returned unexpected result")
+	}
+	for _, bad := range []string{"a.com A=1.1.1.1 []", "a.com A=1.1.1.1 [x,,y]", "a.com [x]"} {
+		if _, err := NewTemplateEntry(bad); err == nil {
+			t.Errorf("expected error for input %q", bad)
+		}
+	}
+}
+
+func TestNewTemplateEntry_Weight(t *testing.T) {
+	te, err := NewTemplateEntry("a.com A=1.1.1.1 || NXDOMAIN weight=2.5 [cdn]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if te.Weight != 2.5 || te.ScoreWeight() != 2.5 || len(te.ValidAnswers) != 2 {
+		t.Fatalf("unexpected entry: %+v", te)
+	}
+	if got := te.ToString(); got != "a.com A=1.1.1.1 || NXDOMAIN weight=2.5 [cdn]" {
+		t.Errorf("unexpected ToString(): %q", got)
+	}
+	rebuilt, err := NewTemplateEntry(te.ToString())
+	if err != nil || !reflect.DeepEqual(te, rebuilt) {
+		t.Errorf("round‑trip mismatch: %+v vs %+v (%v)", te, rebuilt, err)
+	}
+	if te, _ := NewTemplateEntry("a.com NXDOMAIN"); te.ScoreWeight() != 1 {
+		t.Errorf("expected default weight of 1, got %v", te.ScoreWeight())
+	}
+	for _, bad := range []string{"a.com NXDOMAIN weight=0", "a.com NXDOMAIN weight=-1",
+		"a.com NXDOMAIN weight=x", "a.com weight=2", "a.com NXDOMAIN weight=NaN"} {
+		if _, err := NewTemplateEntry(bad); err == nil {
+			t.Errorf("expected error for input %q", bad)
+		}
+	}
+}
+
+// TestTemplate_FilterTags keeps only entries carrying a wanted tag.
+func TestTemplate_FilterTags(t *testing.T) {
+	tpl, err := NewTemplate("a.com NXDOMAIN [nx]\nb.com A=1.1.1.1 [cdn]\nc.com NOERROR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := tpl.FilterTags([]string{"nx", "censorship"})
+	if len(got) != 1 || got[0].Domain != "a.com" {
+		t.Errorf("unexpected filter result: %+v", got)
+	}
+}
+
+// TestNewTemplateFromFiles_Include covers @include, multiple files and
+// error locations inside included files.
+func TestNewTemplateFromFiles_Include(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	write("nx.tpl", "nx.example NXDOMAIN [nx]\n")
+	main := write("main.tpl", "a.example A=1.1.1.1\n@include nx.tpl\nb.example NOERROR\n")
+	other := write("other.tpl", "c.example SERVFAIL\n")
+
+	tpl, err := NewTemplateFromFiles(main, other)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var domains []string
+	for _, e := range tpl {
+		domains = append(domains, e.Domain)
+	}
+	want := []string{"a.example", "nx.example", "b.example", "c.example"}
+	if !reflect.DeepEqual(domains, want) {
+		t.Fatalf("domains = %q, want %q", domains, want)
+	}
+
+	// error inside included file must point at that file and line
+	bad := write("bad.tpl", "ok.example NOERROR\nko.example AAAA=::1\n")
+	withBad := write("with-bad.tpl", "\n@include bad.tpl\n")
+	_, err = NewTemplateFromFiles(withBad)
+	if err == nil || !strings.Contains(err.Error(), bad+" line 2") ||
+		!strings.Contains(err.Error(), withBad+" line 2") {
+		t.Errorf("error should locate bad.tpl line 2; got %v", err)
+	}
+
+	// missing include
+	missing := write("missing.tpl", "@include nope.tpl\n")
+	if _, err := NewTemplateFromFiles(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not‑exist error, got: %v", err)
+	}
+
+	// malformed directive
+	malformed := write("malformed.tpl", "@include a.tpl b.tpl\n")
+	if _, err := NewTemplateFromFiles(malformed); err == nil {
+		t.Error("expected error for malformed @include")
+	}
+}
+
+// TestNewTemplateFromFiles_IncludeCycle ensures include cycles are detected.
+func TestNewTemplateFromFiles_IncludeCycle(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.tpl")
+	b := filepath.Join(dir, "b.tpl")
+	os.WriteFile(a, []byte("a.example NOERROR\n@include b.tpl\n"), 0644)
+	os.WriteFile(b, []byte("b.example NOERROR\n@include a.tpl\n"), 0644)
+
+	_, err := NewTemplateFromFiles(a)
+	if err == nil || !strings.Contains(err.Error(), "@include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+
+	self := filepath.Join(dir, "self.tpl")
+	os.WriteFile(self, []byte("@include self.tpl\n"), 0644)
+	if _, err := NewTemplateFromFiles(self); err == nil {
+		t.Fatal("expected self include cycle error")
+	}
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --------------------------------------------------------------------
+// Template linting
+// --------------------------------------------------------------------
+
+// LintIssue describes a suspicious construct found in a template.
+type LintIssue struct {
+	Entry   *TemplateEntry // offending entry (nil if template-wide)
+	Message string
+}
+
+// LintIssue.String() formats the issue as "<position>: <message>"
+func (li LintIssue) String() string {
+	if li.Entry != nil {
+		if pos := li.Entry.Position(); pos != "" {
+			return pos + ": " + li.Message
+		}
+		return li.Entry.Domain + ": " + li.Message
+	}
+	return "template: " + li.Message
+}
+
+// Lint looks for mistakes NewTemplateEntry() can't catch: duplicate
+// domains, unreachable alternatives, catch-all patterns, TIMEOUT
+// accepted next to non-retryable statuses, and templates too short
+// (less than minEntries entries) to reject anything.
+func (t Template) Lint(minEntries int) []LintIssue {
+	var issues []LintIssue
+	seen := make(map[string]*TemplateEntry, len(t))
+	acceptTimeout := 0
+	for i := range t {
+		entry := &t[i]
+		add := func(format string, a ...interface{}) {
+			issues = append(issues, LintIssue{entry, fmt.Sprintf(format, a...)})
+		}
+		// duplicate domains
+		key := strings.TrimSuffix(strings.ToLower(entry.Domain), ".")
+		if first, found := seen[key]; found {
+			where := first.Position()
+			if where == "" {
+				where = "previous entry"
+			}
+			add("duplicate domain %q (first defined at %s)", entry.Domain, where)
+		} else {
+			seen[key] = entry
+		}
+		// unreachable alternatives
+		for a := range entry.ValidAnswers {
+			for b := range entry.ValidAnswers {
+				alt, other := &entry.ValidAnswers[a], &entry.ValidAnswers[b]
+				if a == b || !answerCovers(other, alt) {
+					continue
+				}
+				if answerCovers(alt, other) && b > a {
+					continue // identical alternatives: only report the last
+				}
+				add("alternative %q can never match: already covered by %q",
+					alt.ToString(), other.ToString())
+				break
+			}
+		}
+		// catch-all patterns
+		for _, alt := range entry.ValidAnswers {
+			for _, rec := range alt.A {
+				if isCatchAll(rec) {
+					add("pattern %q matches any A record", "A="+rec)
+				}
+			}
+			for _, rec := range alt.CNAME {
+				if isCatchAll(rec) {
+					add("pattern %q matches any CNAME record", "CNAME="+rec)
+				}
+			}
+		}
+		// TIMEOUT next to non-retryable statuses
+		if entry.acceptsStatus("TIMEOUT") {
+			acceptTimeout++
+			for _, alt := range entry.ValidAnswers {
+				probe := &DNSAnswer{DNSAnswerData: alt}
+				if alt.Status != "TIMEOUT" && !probe.IsWorthRetrying() {
+					add("accepts TIMEOUT next to non-retryable %s: "+
+						"a timeout passes at once instead of being retried",
+						alt.ToString())
+					break
+				}
+			}
+		}
+	}
+	// template-wide issues
+	if len(t) < minEntries {
+		issues = append(issues, LintIssue{nil, fmt.Sprintf(
+			"only %d entries (< %d): too short to reject anything",
+			len(t), minEntries)})
+	}
+	if len(t) > 0 && acceptTimeout == len(t) {
+		issues = append(issues, LintIssue{nil,
+			"every entry accepts TIMEOUT: unresponsive servers pass the whole template"})
+	}
+	return issues
+}
+
+// acceptsStatus returns true if one of the alternatives has this status.
+func (te *TemplateEntry) acceptsStatus(status string) bool {
+	for _, alt := range te.ValidAnswers {
+		if alt.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// answerCovers returns true if every answer matching `covered` also
+// matches `cover` (patterns of `covered` are treated as values).
+func answerCovers(cover, covered *DNSAnswerData) bool {
+	return cover.Status == covered.Status &&
+		matchRecords(cover.A, covered.A) &&
+		matchRecords(cover.CNAME, covered.CNAME)
+}
+
+// isCatchAll returns true if a record pattern only has '*' and '.'.
+func isCatchAll(pattern string) bool {
+	return strings.ContainsRune(pattern, '*') &&
+		strings.Trim(pattern, "*.") == ""
+}
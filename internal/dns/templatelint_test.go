@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+// lintMessages returns the String() form of every issue found.
+func lintMessages(t *testing.T, content string, minEntries int) []string {
+	t.Helper()
+	tpl, err := NewTemplate(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out []string
+	for _, issue := range tpl.Lint(minEntries) {
+		out = append(out, issue.String())
+	}
+	return out
+}
+
+// TestLint_Clean ensures a sane template yields no issue.
+func TestLint_Clean(t *testing.T) {
+	msgs := lintMessages(t, `
+	a.example A=1.1.1.1 || A=1.1.1.2
+	b.example NXDOMAIN
+	c.example CNAME=x.example. A=10.0.*.1 || SERVFAIL
+	d.example SERVFAIL || TIMEOUT
+	`, 3)
+	if len(msgs) != 0 {
+		t.Fatalf("expected no issue, got %q", msgs)
+	}
+}
+
+// TestLint_Issues covers every per-entry and template-wide check.
+func TestLint_Issues(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"duplicate", "a.example NXDOMAIN\nA.example. NOERROR", `line 2: duplicate domain "A.example." (first defined at line 1)`},
+		{"covered", "a.example A=1.2.3.4 || A=1.2.*", `line 1: alternative "A=1.2.3.4" can never match: already covered by "A=1.2.*"`},
+		{"identical", "a.example NXDOMAIN || NXDOMAIN", `line 1: alternative "NXDOMAIN" can never match`},
+		{"catch-all A", "a.example A=*.*.*.*", `line 1: pattern "A=*.*.*.*" matches any A record`},
+		{"catch-all CNAME", "a.example CNAME=* A=1.1.1.1", `line 1: pattern "CNAME=*" matches any CNAME record`},
+		{"timeout", "a.example NXDOMAIN || TIMEOUT", `line 1: accepts TIMEOUT next to non-retryable NXDOMAIN`},
+		{"too short", "a.example NXDOMAIN", `template: only 1 entries (< 3)`},
+		{"all timeout", "a.example TIMEOUT\nb.example SERVFAIL || TIMEOUT", `template: every entry accepts TIMEOUT`},
+	}
+	for _, c := range cases {
+		msgs := lintMessages(t, c.content, 3)
+		found := false
+		for _, msg := range msgs {
+			if strings.HasPrefix(msg, c.want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected issue %q, got %q", c.name, c.want, msgs)
+		}
+	}
+}
+
+// TestLint_IdenticalReportedOnce makes sure duplicate alternatives are
+// reported only once, on the last occurrence.
+func TestLint_IdenticalReportedOnce(t *testing.T) {
+	msgs := lintMessages(t, "a.example NXDOMAIN || NXDOMAIN\nb.example NOERROR\nc.example SERVFAIL", 3)
+	if len(msgs) != 1 {
+		t.Fatalf("expected exactly 1 issue, got %q", msgs)
+	}
+}
+
+// TestLintIssue_String covers position formatting fallbacks.
+func TestLintIssue_String(t *testing.T) {
+	entry := &TemplateEntry{Domain: "a.example"}
+	if got := (LintIssue{entry, "msg"}).String(); got != "a.example: msg" {
+		t.Errorf("unexpected String(): %q", got)
+	}
+	entry.File, entry.Line = "x.tpl", 4
+	if got := (LintIssue{entry, "msg"}).String(); got != "x.tpl:4: msg" {
+		t.Errorf("unexpected String(): %q", got)
+	}
+}
@@ -0,0 +1,60 @@
+package dnsanitize
+
+import (
+	"strings"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// aimdSteps is the number of clean answers needed to climb from the
+// min to the max rate (additive increase step = range / aimdSteps).
+const aimdSteps = 20
+
+// RateController adapts the rate limit of each server (AIMD): it is
+// halved when a server which already answered starts returning REFUSED
+// or TIMEOUT, and increased by a constant step on clean answers.
+// It is only used by the scheduler goroutine.
+type RateController struct {
+	MinRate float64 // lowest rate (req/s)
+	MaxRate float64 // highest rate (req/s)
+	step    float64 // additive increase (req/s)
+}
+
+// NewRateController returns a RateController bound to [minRate, maxRate]
+func NewRateController(minRate, maxRate float64) *RateController {
+	return &RateController{
+		MinRate: minRate,
+		MaxRate: maxRate,
+		step:    (maxRate - minRate) / aimdSteps,
+	}
+}
+
+// Init sets the starting rate of a newly loaded server.
+// An unlimited rate (0) starts at MaxRate.
+func (rc *RateController) Init(srv *dns.ServerContext, rate float64) {
+	if rate <= 0 {
+		rate = rc.MaxRate
+	}
+	srv.RateLimit = min(max(rate, rc.MinRate), rc.MaxRate)
+	srv.AdaptiveRate = true
+}
+
+// Update adapts srv.RateLimit to the answer it just returned.
+func (rc *RateController) Update(srv *dns.ServerContext, answer *dns.DNSAnswer) {
+	if answer == nil {
+		return
+	}
+	switch answer.Status {
+	case "REFUSED", "TIMEOUT":
+		// only a sign of overload if the server answered before
+		if srv.AnsweredCount > 0 {
+			srv.RateLimit = max(srv.RateLimit/2, rc.MinRate)
+		}
+	default:
+		if strings.HasPrefix(answer.Status, "ERROR") {
+			return // local error: no feedback from the server
+		}
+		srv.AnsweredCount++
+		srv.RateLimit = min(srv.RateLimit+rc.step, rc.MaxRate)
+	}
+}
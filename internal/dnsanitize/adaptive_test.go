@@ -0,0 +1,131 @@
+package dnsanitize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+func answerWithStatus(status string) *dns.DNSAnswer {
+	return &dns.DNSAnswer{DNSAnswerData: dns.DNSAnswerData{Status: status}}
+}
+
+func TestRateControllerInit(t *testing.T) {
+	rc := NewRateController(1, 10)
+	cases := []struct {
+		initial, want float64
+	}{
+		{0, 10},  // unlimited -> max
+		{0.5, 1}, // clamped to min
+		{4, 4},   // within range
+		{50, 10}, // clamped to max
+	}
+	for _, c := range cases {
+		srv := &dns.ServerContext{}
+		rc.Init(srv, c.initial)
+		if srv.RateLimit != c.want || !srv.AdaptiveRate {
+			t.Errorf("Init(%v): rate=%v adaptive=%v, want %v",
+				c.initial, srv.RateLimit, srv.AdaptiveRate, c.want)
+		}
+	}
+}
+
+func TestRateControllerAIMD(t *testing.T) {
+	rc := NewRateController(1, 21) // step = 1 req/s
+	srv := &dns.ServerContext{}
+	rc.Init(srv, 8)
+
+	// TIMEOUT / REFUSED before any answer: unresponsive, not overloaded
+	rc.Update(srv, answerWithStatus("TIMEOUT"))
+	rc.Update(srv, answerWithStatus("REFUSED"))
+	if srv.RateLimit != 8 {
+		t.Fatalf("rate changed before first answer: %v", srv.RateLimit)
+	}
+	// clean answers -> additive increase
+	rc.Update(srv, answerWithStatus("NOERROR"))
+	rc.Update(srv, answerWithStatus("NXDOMAIN"))
+	if srv.RateLimit != 10 || srv.AnsweredCount != 2 {
+		t.Fatalf("after 2 answers: rate=%v answered=%d, want 10/2",
+			srv.RateLimit, srv.AnsweredCount)
+	}
+	// local errors are ignored
+	rc.Update(srv, answerWithStatus("ERROR - no route"))
+	rc.Update(srv, nil)
+	if srv.RateLimit != 10 {
+		t.Fatalf("local error changed rate: %v", srv.RateLimit)
+	}
+	// congestion -> multiplicative decrease, bounded by MinRate
+	rc.Update(srv, answerWithStatus("REFUSED"))
+	if srv.RateLimit != 5 {
+		t.Fatalf("after REFUSED: rate=%v, want 5", srv.RateLimit)
+	}
+	for i := 0; i < 10; i++ {
+		rc.Update(srv, answerWithStatus("TIMEOUT"))
+	}
+	if srv.RateLimit != 1 {
+		t.Fatalf("rate should stop at MinRate: %v", srv.RateLimit)
+	}
+	// and back up to MaxRate
+	for i := 0; i < 100; i++ {
+		rc.Update(srv, answerWithStatus("NOERROR"))
+	}
+	if srv.RateLimit != 21 {
+		t.Fatalf("rate should stop at MaxRate: %v", srv.RateLimit)
+	}
+}
+
+// TestScheduleChecksAdaptive runs the scheduler in adaptive mode and
+// checks that a REFUSED answer lowers the rate learned by each server.
+func TestScheduleChecksAdaptive(t *testing.T) {
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		status := "NXDOMAIN"
+		if domain == "b.invalid" {
+			status = "REFUSED"
+		}
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: status}}
+	})
+
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "b.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "c.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+	}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           []string{"192.0.2.1", "192.0.2.2"},
+		Template:            tpl,
+		MaxThreads:          4,
+		MaxPoolSize:         2,
+		GlobRateLimit:       100,
+		PerSrvRateLimit:     8,
+		PerSrvAdaptiveRate:  true,
+		PerSrvMinRateLimit:  1,
+		PerSrvMaxRateLimit:  21,
+		PerSrvMaxFailures:   2,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	var rates []float64
+	st.OnServerFinished = func(srv *dns.ServerContext) {
+		if !srv.AdaptiveRate {
+			t.Errorf("%s: AdaptiveRate not set", srv.IPAddress)
+		}
+		rates = append(rates, srv.RateLimit)
+	}
+	DNSanitize(settings, st)
+	if len(rates) != 2 {
+		t.Fatalf("expected 2 finished servers, got %d", len(rates))
+	}
+	for _, rate := range rates {
+		if rate >= 8 || rate < 1 {
+			t.Errorf("learned rate %v should be within [1, 8)", rate)
+		}
+	}
+}
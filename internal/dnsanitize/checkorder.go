@@ -0,0 +1,87 @@
+package dnsanitize
+
+import (
+	"sort"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// CheckOrder tracks how often each template entry fails across finished
+// servers, and makes newly loaded servers run the entries most likely to
+// fail first, so that bad servers get dropped sooner.
+// All methods are single-goroutine – no mutex needed.
+type CheckOrder struct {
+	runs  []int // entry idx ➜ finished servers which ran it
+	fails []int // entry idx ➜ finished servers which failed it
+	order []int // cached order (most failing entries first)
+	dirty bool  // order must be recomputed
+}
+
+// NewCheckOrder returns a CheckOrder for a template of numChecks entries,
+// initially in template order.
+func NewCheckOrder(numChecks int) *CheckOrder {
+	co := &CheckOrder{
+		runs:  make([]int, numChecks),
+		fails: make([]int, numChecks),
+		order: make([]int, numChecks),
+	}
+	for i := range co.order {
+		co.order[i] = i
+	}
+	return co
+}
+
+// failRate estimates the failure probability of an entry. Laplace
+// smoothing makes entries never run so far start at 0.5.
+func (co *CheckOrder) failRate(idx int) float64 {
+	return float64(co.fails[idx]+1) / float64(co.runs[idx]+2)
+}
+
+// Observe records the verdicts of a finished server.
+func (co *CheckOrder) Observe(srv *dns.ServerContext) {
+	for i, chk := range srv.Checks {
+		if chk.Answer.Status == "SKIPPED" {
+			continue // never ran
+		}
+		co.runs[i]++
+		if !chk.Passed {
+			co.fails[i]++
+		}
+		co.dirty = true
+	}
+}
+
+// Apply reorders the pending checks of a newly loaded server.
+func (co *CheckOrder) Apply(srv *dns.ServerContext) {
+	if co.dirty {
+		sort.SliceStable(co.order, func(i, j int) bool {
+			return co.failRate(co.order[i]) > co.failRate(co.order[j])
+		})
+		co.dirty = false
+	}
+	srv.PendingChecks = append(srv.PendingChecks[:0], co.order...)
+}
+
+// SavedQueries estimates how many queries the reordering saved on a
+// dropped server: the queries a template-ordered run would have sent
+// until reaching the same failures, minus the queries actually sent.
+// Checks never run are assumed to cost one query.
+// The result is negative if template order would have been cheaper.
+func SavedQueries(srv *dns.ServerContext) int {
+	if !srv.Disabled {
+		return 0 // valid servers run every check anyway
+	}
+	saved, failed := 0, 0
+	for _, chk := range srv.Checks {
+		if failed < srv.FailedCount {
+			saved += max(chk.MaxAttempts-chk.AttemptsLeft, 1)
+		}
+		if chk.Answer.Status != "SKIPPED" {
+			saved -= chk.MaxAttempts - chk.AttemptsLeft
+			if !chk.Passed {
+				failed++
+			}
+		}
+	}
+	return saved
+}
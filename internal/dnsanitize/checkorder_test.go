@@ -0,0 +1,116 @@
+package dnsanitize
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// finishedServer builds a ServerContext whose checks got the given
+// verdicts ('+' passed, '-' failed, ' ' never ran), in one attempt each.
+func finishedServer(tpl dns.Template, verdicts string) *dns.ServerContext {
+	srv := dns.NewServerContext("192.0.2.1", tpl, 1)
+	for i, v := range verdicts {
+		if v == ' ' {
+			continue
+		}
+		srv.Checks[i].AttemptsLeft = 0
+		srv.Checks[i].Answer = &dns.DNSAnswer{
+			DNSAnswerData: dns.DNSAnswerData{Status: "NOERROR"}}
+		srv.Checks[i].Passed = v == '+'
+		srv.CompletedCount++
+		if v == '-' {
+			srv.FailedCount++
+			srv.Disabled = true
+		}
+	}
+	return srv
+}
+
+func TestCheckOrderApply(t *testing.T) {
+	tpl := make(dns.Template, 4)
+	co := NewCheckOrder(len(tpl))
+
+	// no data yet: template order
+	srv := dns.NewServerContext("192.0.2.1", tpl, 1)
+	co.Apply(srv)
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(srv.PendingChecks, want) {
+		t.Fatalf("initial order = %v, want %v", srv.PendingChecks, want)
+	}
+	// entry 2 fails often, entry 0 always passes, entry 3 never ran
+	co.Observe(finishedServer(tpl, "++- "))
+	co.Observe(finishedServer(tpl, "+- "))
+	co.Observe(finishedServer(tpl, "+ - "))
+	srv = dns.NewServerContext("192.0.2.2", tpl, 1)
+	co.Apply(srv)
+	// rates: 0=1/5 1=2/4 2=4/5 3=1/2 (stable for equal rates)
+	if want := []int{2, 1, 3, 0}; !reflect.DeepEqual(srv.PendingChecks, want) {
+		t.Fatalf("learned order = %v, want %v", srv.PendingChecks, want)
+	}
+}
+
+func TestSavedQueries(t *testing.T) {
+	tpl := make(dns.Template, 4)
+	cases := []struct {
+		verdicts string
+		want     int
+	}{
+		{"++++", 0},  // valid server: nothing saved
+		{"   -", 3},  // template order would have run 4 checks
+		{"-   ", 0},  // first check failed anyway
+		{"+++-", 0},  // ran as in template order
+		{"-+  ", -1}, // a template-ordered run would stop at check 0
+	}
+	for _, c := range cases {
+		if got := SavedQueries(finishedServer(tpl, c.verdicts)); got != c.want {
+			t.Errorf("SavedQueries(%q) = %d, want %d", c.verdicts, got, c.want)
+		}
+	}
+}
+
+// TestScheduleChecksCheckOrder checks that once the failing entry is
+// known, later servers run it first and get dropped after one query.
+func TestScheduleChecksCheckOrder(t *testing.T) {
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "NXDOMAIN"}}
+	})
+
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "b.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "c.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "d.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NOERROR"}}},
+	}
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           ips,
+		Template:            tpl,
+		MaxThreads:          1,
+		MaxPoolSize:         1, // one server at a time
+		GlobRateLimit:       100,
+		PerSrvMaxFailures:   0,
+		PerSrvCheckOrder:    true,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	DNSanitize(settings, st)
+	if st.InvalidServers != len(ips) {
+		t.Fatalf("expected %d invalid servers, got %d", len(ips), st.InvalidServers)
+	}
+	// 1st server runs 4 queries, the others only 1
+	if got := st.Requests.Total(); got != 4+len(ips)-1 {
+		t.Fatalf("expected %d requests, got %d", 4+len(ips)-1, got)
+	}
+	if st.SavedQueries != 3*(len(ips)-1) {
+		t.Fatalf("expected %d saved queries, got %d", 3*(len(ips)-1), st.SavedQueries)
+	}
+}
@@ -1,12 +1,12 @@
 package dnsanitize
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/nil0x42/dnsanity/internal/config"
 	"github.com/nil0x42/dnsanity/internal/dns"
-	"github.com/nil0x42/dnsanity/internal/report"
 )
 
 // ---------------------------------------------------------------------------
@@ -19,12 +19,14 @@ type WorkerResult struct {
 	CheckID int            // check index
 	Answer  *dns.DNSAnswer // received answer
 	Passed  bool           // equals? result
+	Elapsed time.Duration  // query duration
 }
 
 type QueryScheduler struct {
 	waitGroup   sync.WaitGroup
 	JobLimiter  chan struct{}
 	RateLimiter *RateLimiter
+	Resolver    dns.Resolver      // sends the DNS queries
 	Results     chan WorkerResult // worker results are sent here
 }
 
@@ -37,13 +39,21 @@ func runDNSWorker(
 	sched *QueryScheduler, // scheduler
 ) {
 	defer sched.waitGroup.Done()
-	answer := dns.ResolveDNS(check.Domain, srv.IPAddress, timeout, srv.Ctx)
+	start := time.Now()
+	answer := sched.Resolver.Resolve(
+		check.Domain, srv.IPAddress, timeout, srv.Ctx)
+	elapsed := time.Since(start)
+	passed := check.Matches(answer)
 	sched.Results <- WorkerResult{
 		SrvID:   srvID,
 		CheckID: checkID,
 		Answer:  answer,
-		Passed:  check.Matches(answer),
+		Passed:  passed,
+		Elapsed: elapsed,
 	}
+	// free the job slot AFTER sending the result: unreceived results can
+	// never outnumber job slots, so sends never block (Results has as
+	// many slots as JobLimiter).
 	<-sched.JobLimiter
 }
 
@@ -54,29 +64,59 @@ func runDNSWorker(
 // ---------------------------------------------------------------------------
 func DNSanitize(
 	s *config.Settings,
-	status *report.StatusReporter,
+	status Reporter,
+) {
+	DNSanitizeContext(context.Background(), s, status)
+}
+
+// DNSanitizeContext is like DNSanitize, but stops early once ctx is done:
+// no new query is scheduled, in-flight ones are cancelled, and servers
+// which hadn't finished are reported as untested.
+func DNSanitizeContext(
+	ctx context.Context,
+	s *config.Settings,
+	status Reporter,
 ) {
 	qryTimeout := time.Duration(s.PerQueryTimeout) * time.Second
-	srvReqInterval := time.Duration(0)
-	if s.PerSrvRateLimit > 0 {
-		srvReqInterval = time.Duration(float64(time.Second) / s.PerSrvRateLimit)
+	var rateCtl *RateController // nil: fixed per-server rate limit
+	if s.PerSrvAdaptiveRate {
+		rateCtl = NewRateController(s.PerSrvMinRateLimit, s.PerSrvMaxRateLimit)
+	}
+	var checkOrder *CheckOrder // nil: template order
+	if s.PerSrvCheckOrder {
+		checkOrder = NewCheckOrder(len(s.Template))
+	}
+	retry := NewRetryPolicy(s.RetryOn, s.FastFail, s.RetryBackoff)
+	var netLimiter *NetLimiter // nil: no per-network rate limit
+	if s.NetRateLimit > 0 || s.ASNRateLimit > 0 {
+		netLimiter = NewNetLimiter(
+			s.NetRateLimit, s.NetPrefix4, s.NetPrefix6,
+			s.ASNRateLimit, s.ASNDB)
 	}
 
 	// init server pool
 	pool := NewServerPool(
-		s.MaxPoolSize, s.ServerIPs, s.Template, s.PerCheckMaxAttempts)
+		s.MaxPoolSize, s.Servers(), s.Template, s.PerCheckMaxAttempts)
 
 	// init scheduler
-	maxThreads := min(s.MaxThreads, len(s.ServerIPs)*len(s.Template))
+	maxThreads := s.MaxThreads
+	if numServers, known := s.NumServers(); known {
+		maxThreads = min(maxThreads, numServers*len(s.Template))
+	}
 	sched := &QueryScheduler{
 		JobLimiter:  make(chan struct{}, maxThreads),
 		Results:     make(chan WorkerResult, maxThreads),
 		RateLimiter: NewRateLimiter(s.GlobRateLimit, time.Second),
+		Resolver:    s.Resolver,
+	}
+	if sched.Resolver == nil {
+		sched.Resolver = dns.UDPResolver
 	}
 	// Run the scheduling loop to fill out servers
 	scheduleChecks(
-		pool, s.Template, sched, status,
-		qryTimeout, srvReqInterval, s.PerSrvMaxFailures,
+		ctx, pool, s.Template, sched, status,
+		qryTimeout, s.PerSrvRateLimit, rateCtl, checkOrder, netLimiter,
+		retry, s.PerSrvMaxFailures, s.PerSrvMinScore,
 	)
 	// stop gobal ratelimiter
 	sched.RateLimiter.StopRefiller()
@@ -84,37 +124,103 @@ func DNSanitize(
 
 // scheduleChecks is the core scheduler that dispatches DNS queries,
 // observes concurrency limits, rate limits, and failure thresholds.
+//
+// It is event-driven: servers with pending checks wait in a min-heap
+// keyed by their NextQueryAt deadline, and the loop sleeps until a worker
+// result arrives, the earliest deadline expires, the global RateLimiter
+// is refilled, or new servers are read from a pipe (never waited for).
+// Each iteration only visits servers which are ready.
+//
+// Each server starts at srvRateLimit req/s; if rateCtl is not nil, this
+// rate is then adapted from the answers the server returns.
+// If checkOrder is not nil, new servers run the most failing checks first.
+// If netLimiter is not nil, servers of a rate-limited network wait in the
+// heap until the network's next allowed query time.
+// Failed checks are retried (or drop their server at once) according to
+// retry.
+//
+// Once ctx is done, unfinished servers are cancelled and reported as
+// untested.
 func scheduleChecks(
+	ctx context.Context,
 	pool *ServerPool,
 	template dns.Template,
 	sched *QueryScheduler,
-	status *report.StatusReporter,
+	status Reporter,
 	qryTimeout time.Duration,
-	srvReqInterval time.Duration,
+	srvRateLimit float64,
+	rateCtl *RateController,
+	checkOrder *CheckOrder,
+	netLimiter *NetLimiter,
+	retry *RetryPolicy,
 	srvMaxFailures int,
+	srvMinScore float64,
 ) {
 	inFlight := make(map[int]int)
-	for {
+	// jobs whose result wasn't received yet (their JobLimiter slot may
+	// be released a bit later, right after the result is sent)
+	numBusy := 0
+	// syncTotal reports total servers changes, as the source is read
+	// (duplicates skipped, or total unknown until EOF).
+	reportedTotal, reportedKnown := pool.source.Total()
+	syncTotal := func() {
+		total, known := pool.source.Total()
+		if total != reportedTotal || known != reportedKnown {
+			status.AddTotalServers(total-reportedTotal, known)
+			reportedTotal, reportedKnown = total, known
+		}
+	}
+	queue := NewSrvQueue()
+	timer := time.NewTimer(time.Hour)
+	stopTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C: // drain (pre go1.23 timers)
+			default:
+			}
+		}
+	}
+	stopTimer()
+	defer stopTimer()
+
+	handleResult := func(res WorkerResult) {
+		numBusy--
+		// request done -> decrement inFlight count
+		if n := inFlight[res.SrvID]; n > 1 {
+			inFlight[res.SrvID] = n - 1
+		} else { // <=0
+			delete(inFlight, res.SrvID)
+		}
+		srv, srvExists := pool.Get(res.SrvID)
+		if !srvExists { // server already dropped
+			return
+		}
+		if rateCtl != nil {
+			rateCtl.Update(srv, res.Answer)
+		}
+		applyResults(srv, &res, retry, srvMaxFailures, status)
+		if srv.Finished() {
+			if !srv.Disabled && srvMinScore > 0 && srv.Score() < srvMinScore {
+				srv.Disabled = true // not reliable enough
+			}
+			if checkOrder != nil {
+				checkOrder.Observe(srv)
+				status.AddSavedQueries(SavedQueries(srv))
+			}
+			status.ReportFinishedServer(srv) // report server
+			pool.Unload(res.SrvID)           // drop server from pool
+		} else if len(srv.PendingChecks) > 0 {
+			queue.Push(res.SrvID, srv.NextQueryAt) // retry re-queued
+		}
+	}
+
+	for ctx.Err() == nil {
 		// 1) async collection of worker results -----------------------------
 	collectLoop:
 		for {
 			select {
 			case res := <-sched.Results:
-				// request done -> decrement inFlight count
-				if n := inFlight[res.SrvID]; n > 1 {
-					inFlight[res.SrvID] = n - 1
-				} else { // <=0
-					delete(inFlight, res.SrvID)
-				}
-				srv, srvExists := pool.Get(res.SrvID)
-				if !srvExists { // server already dropped
-					continue
-				}
-				applyResults(srv, &res, srvMaxFailures, status)
-				if srv.Finished() {
-					status.ReportFinishedServer(srv) // report server
-					pool.Unload(res.SrvID)           // drop server from pool
-				}
+				handleResult(res)
 			default:
 				break collectLoop
 			}
@@ -124,48 +230,91 @@ func scheduleChecks(
 		now := time.Now()
 		numScheduled, numScheduledBusy, numScheduledIdle := 0, 0, 0
 		poolCanGrow := pool.CanGrow()
-		busyJobs := len(sched.JobLimiter)
+		busyJobs := numBusy
 		freeJobs := cap(sched.JobLimiter) - busyJobs
-		// Two passes : first IDLE servers, then BUSY (inFlight).
-		// Second pass is allowed ONLY when the pool cannot grow anymore.
-		for pass := 0; pass < 2 && freeJobs > 0; pass++ {
-			if pass == 1 && poolCanGrow {
-				break // skip BUSY pass if pool can grow
-			}
-			for srvID, srv := range pool.pool {
-				idle := inFlight[srvID] == 0 // not in inFlight: srv is idle
-				if                           ///////////////////////////////// SKIP SERVER IF:
-				(pass == 0 && !idle) ||      // - BUSY srv on IDLE pass
-					(pass == 1 && idle) || // - IDLE srv on BUSY pass
-					len(srv.PendingChecks) == 0 || // - nothing to do now
-					srv.NextQueryAt.After(now) || // - per‑server rate‑limit
-					!sched.RateLimiter.ConsumeOne() { // - global RPS exceeded
-					continue
-				}
-				select {
-				case sched.JobLimiter <- struct{}{}:
-					// We can schedule a new test for this server
-					inFlight[srvID]++
-					busyJobs = max(busyJobs, len(sched.JobLimiter))
-					checkID := srv.PendingChecks[0]
-					srv.PendingChecks = srv.PendingChecks[1:]
-					sched.waitGroup.Add(1)
-					go runDNSWorker(
-						srv, &template[checkID],
-						srvID, checkID, qryTimeout, sched,
-					)
-					srv.NextQueryAt = now.Add(srvReqInterval)
-					freeJobs--
-					numScheduled++
-					if idle {
-						numScheduledIdle++
-					} else {
-						numScheduledBusy++
-					}
-				default:
-					// No free worker slot: give back the consumed token
-					sched.RateLimiter.GiveBackOne()
-				}
+		rateLimited := false
+		// netAllowed tells if srv's network may be queried now, else
+		// re-queues srv until the network's next allowed query time.
+		netAllowed := func(srvID int, srv *dns.ServerContext) bool {
+			if netLimiter == nil {
+				return true
+			}
+			at, ok := netLimiter.NextAllowed(srv.IPAddress, now)
+			if !ok {
+				queue.Push(srvID, at)
+			}
+			return ok
+		}
+		launch := func(srvID int, srv *dns.ServerContext, idle bool) {
+			if netLimiter != nil {
+				netLimiter.Consume(srv.IPAddress, now)
+			}
+			// may only wait for a worker whose result was received to
+			// release its slot
+			sched.JobLimiter <- struct{}{}
+			numBusy++
+			inFlight[srvID]++
+			busyJobs = max(busyJobs, numBusy)
+			checkID := srv.PendingChecks[0]
+			srv.PendingChecks = srv.PendingChecks[1:]
+			sched.waitGroup.Add(1)
+			go runDNSWorker(
+				srv, &template[checkID],
+				srvID, checkID, qryTimeout, sched,
+			)
+			srv.NextQueryAt = now.Add(srv.ReqInterval())
+			if len(srv.PendingChecks) > 0 {
+				queue.Push(srvID, srv.NextQueryAt)
+			}
+			freeJobs--
+			numScheduled++
+			if idle {
+				numScheduledIdle++
+			} else {
+				numScheduledBusy++
+			}
+		}
+		// Ready IDLE servers go first. Ready BUSY (inFlight) servers are
+		// only scheduled when the pool cannot grow anymore, else parked.
+		queue.UnparkAll()
+		var busyReady []int
+		for freeJobs > 0 && !rateLimited {
+			srvID, ok := queue.PopReady(now)
+			if !ok {
+				break // no other server ready
+			}
+			srv, srvExists := pool.Get(srvID)
+			if !srvExists || len(srv.PendingChecks) == 0 {
+				continue
+			}
+			if srv.NextQueryAt.After(now) {
+				// deadline pushed back since queued (retry backoff), or
+				// unparked: wait for it
+				queue.Push(srvID, srv.NextQueryAt)
+				continue
+			}
+			if inFlight[srvID] > 0 {
+				busyReady = append(busyReady, srvID)
+			} else if !netAllowed(srvID, srv) {
+				continue // network rate limit exceeded
+			} else if sched.RateLimiter.ConsumeOne() {
+				launch(srvID, srv, true)
+			} else { // global RPS exceeded
+				queue.Push(srvID, srv.NextQueryAt)
+				rateLimited = true
+			}
+		}
+		for _, srvID := range busyReady {
+			srv, _ := pool.Get(srvID)
+			if poolCanGrow || freeJobs == 0 || rateLimited {
+				queue.Park(srvID)
+			} else if !netAllowed(srvID, srv) {
+				continue // network rate limit exceeded
+			} else if sched.RateLimiter.ConsumeOne() {
+				launch(srvID, srv, false)
+			} else { // global RPS exceeded
+				queue.Park(srvID)
+				rateLimited = true
 			}
 		}
 		// notify num of requests just scheduled (for RPS count)
@@ -174,6 +323,7 @@ func scheduleChecks(
 			status.UpdateBusyJobs(busyJobs)
 		}
 		// 3) termination condition ------------------------------------------
+		syncTotal()
 		if pool.IsDrained() {
 			break // every server processed and pool emptied
 		}
@@ -183,16 +333,67 @@ func scheduleChecks(
 			freeReqs := sched.RateLimiter.Remaining()
 			toLoad := min(freeReqs, freeJobs)
 			if toLoad > 0 {
-				poolGrowth = pool.LoadN(toLoad)
+				for _, slot := range pool.LoadN(toLoad) {
+					srv, _ := pool.Get(slot)
+					if rateCtl != nil {
+						rateCtl.Init(srv, srvRateLimit)
+					} else {
+						srv.RateLimit = srvRateLimit
+					}
+					if checkOrder != nil {
+						checkOrder.Apply(srv)
+					}
+					queue.Push(slot, time.Time{}) // ready now
+					poolGrowth++
+				}
 				if poolGrowth > 0 {
 					status.UpdatePoolSize(pool.Len())
 					status.Debug("expand pool by %d. newsz=%d", poolGrowth, pool.Len())
 				}
 			}
 		}
+		// 5) sleep until something happens ---------------------------------
 		if numScheduled == 0 && poolGrowth == 0 {
 			status.UpdatePoolSize(pool.Len())
-			time.Sleep(13 * time.Millisecond) // avoid busy‑wait
+			var timerC <-chan time.Time // next server deadline
+			if at, ok := queue.NextDeadline(); ok && freeJobs > 0 && !rateLimited {
+				timer.Reset(time.Until(at))
+				timerC = timer.C
+			}
+			var refillC <-chan struct{} // global rate-limiter refill
+			if rateLimited || (poolCanGrow && freeJobs > 0) {
+				refillC = sched.RateLimiter.Refilled()
+			}
+			select {
+			case res := <-sched.Results:
+				handleResult(res)
+			case <-timerC:
+			case <-refillC:
+			case <-pool.Ready(): // new servers read from the source
+			case <-ctx.Done():
+			}
+			if timerC != nil {
+				stopTimer()
+			}
+		}
+	}
+	// INTERRUPTED) cancel in-flight queries, unfinished servers are untested
+	if ctx.Err() != nil {
+		untested := pool.NumPending()
+		pool.Release() // unloaded servers stay readable from the source
+		for _, srv := range pool.UnloadAll() {
+			srv.CancelCtx()
+			status.ReportUntestedServer(srv)
+			untested++
+		}
+		status.AddUntestedServers(untested)
+		status.Debug("interrupted (%v): %d untested servers", ctx.Err(), untested)
+		// discard results of cancelled queries until workers are done
+		go func() {
+			sched.waitGroup.Wait()
+			close(sched.Results)
+		}()
+		for range sched.Results {
 		}
 	}
 	// END) Once all works are done, wait for remaining workers
@@ -201,16 +402,20 @@ func scheduleChecks(
 
 // applyResults updates a ServerContext after one DNS query
 // and reflects the change into the shared Status struct.
+// A retry backoff pushes srv.NextQueryAt: as the retried check is queued
+// first, all pending checks of the server wait for it too.
 // This runs in the scheduler goroutine (single-threaded),
 func applyResults(
 	srv *dns.ServerContext, // server
 	res *WorkerResult, // worker result
+	retry *RetryPolicy, // retry policy
 	srvMaxFailures int, // max allowed non-passing checks per server
-	status *report.StatusReporter,
+	status Reporter,
 ) {
 	chk := &srv.Checks[res.CheckID]
 	chk.AttemptsLeft--
 	chk.Answer = res.Answer
+	chk.Elapsed += res.Elapsed
 	/* ---------- success ------------------------------------------------ */
 	if res.Passed {
 		chk.Passed = true
@@ -219,17 +424,22 @@ func applyResults(
 		return
 	}
 	/* ---------- failure, retry remaining ------------------------------- */
-	if chk.AttemptsLeft > 0 && res.Answer.IsWorthRetrying() {
-		// re-queue the check at the front
+	fastFail := retry.IsFastFail(res.Answer)
+	if !fastFail && chk.AttemptsLeft > 0 && retry.ShouldRetry(res.Answer) {
+		// re-queue the check at the front, after backoff
 		srv.PendingChecks = append([]int{res.CheckID}, srv.PendingChecks...)
+		delay := retry.Delay(chk.MaxAttempts - chk.AttemptsLeft)
+		if at := time.Now().Add(delay); delay > 0 && at.After(srv.NextQueryAt) {
+			srv.NextQueryAt = at
+		}
 		status.AddDoneChecks(+1, +1) // +1 done, +1 total
 		return
 	}
 	/* ---------- failure, no retry left --------------------------------- */
 	srv.CompletedCount++
 	srv.FailedCount++
-	// reached drop threshold?
-	if srv.FailedCount >= srvMaxFailures {
+	// reached drop threshold? (fast-fail: drop at once)
+	if fastFail || srv.FailedCount >= srvMaxFailures {
 		// how many planned checks are immediately cancelled
 		cancelledChecks := len(srv.Checks) - srv.CompletedCount
 		status.AddDoneChecks(+1, -cancelledChecks)
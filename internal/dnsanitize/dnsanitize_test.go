@@ -7,7 +7,10 @@ package dnsanitize
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"os"
 	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -23,6 +26,8 @@ import (
 // Helpers -------------------------------------------------------------------
 // ---------------------------------------------------------------------------
 
+var _ Reporter = (*report.StatusReporter)(nil)
+
 // newIOFiles returns an empty IOFiles ready to be embedded inside a
 // StatusReporter. Every file writer is nil, which is fine because the
 // implementation checks for nil before writing.
@@ -52,6 +57,27 @@ func newStatus() *report.StatusReporter {
 	return sr
 }
 
+// syntheticIPs returns n distinct IPs (10.0.0.0/8), for simulated servers.
+func syntheticIPs(n int) []string {
+	ips := make([]string, n)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+	return ips
+}
+
+// nxdomainTemplate returns a template of n checks expecting NXDOMAIN.
+func nxdomainTemplate(n int) dns.Template {
+	tpl := make(dns.Template, n)
+	for i := range tpl {
+		tpl[i] = dns.TemplateEntry{
+			Domain:       fmt.Sprintf("check%d.invalid", i),
+			ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}},
+		}
+	}
+	return tpl
+}
+
 // helperServer creates a minimal ServerContext with the desired AttemptsLeft.
 func helperServer(attempts int) *dns.ServerContext {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -100,7 +126,7 @@ func TestApplyResultsPaths(t *testing.T) {
 
 	// Success path ---------------------------------------------------------
 	srv := helperServer(1)
-	applyResults(srv, &res, 1, st)
+	applyResults(srv, &res, DefaultRetryPolicy(), 1, st)
 	if srv.CompletedCount != 1 || srv.FailedCount != 0 || !srv.Checks[0].Passed {
 		t.Fatal("applyResults success path failed")
 	}
@@ -109,14 +135,19 @@ func TestApplyResultsPaths(t *testing.T) {
 	srv = helperServer(2)
 	res.Passed = false
 	res.Answer = &dns.DNSAnswer{DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"}}
-	applyResults(srv, &res, 2, st)
+	res.Elapsed = time.Second
+	applyResults(srv, &res, DefaultRetryPolicy(), 2, st)
 	if len(srv.PendingChecks) != 1 || srv.Checks[0].AttemptsLeft != 1 {
 		t.Fatal("applyResults retry path incorrect")
 	}
+	applyResults(srv, &res, DefaultRetryPolicy(), 2, st)
+	if srv.Checks[0].Elapsed != 2*time.Second {
+		t.Fatalf("expected elapsed time of both attempts, got %s", srv.Checks[0].Elapsed)
+	}
 
 	// Final failure → server disabled when maxFailures reached -------------
 	srv = helperServer(1)
-	applyResults(srv, &res, 0, st) // maxFailures==0 → immediate drop
+	applyResults(srv, &res, DefaultRetryPolicy(), 0, st) // maxFailures==0 → immediate drop
 	if !srv.Disabled || srv.FailedCount != 1 {
 		t.Fatal("applyResults final failure logic incorrect")
 	}
@@ -137,6 +168,7 @@ func TestRunDNSWorker(t *testing.T) {
 	sched := &QueryScheduler{
 		JobLimiter:  make(chan struct{}, 1),
 		RateLimiter: NewRateLimiter(1, time.Second),
+		Resolver:    dns.UDPResolver,
 		Results:     make(chan WorkerResult, 1),
 	}
 	sched.JobLimiter <- struct{}{} // occupy one slot
@@ -229,3 +261,280 @@ func TestDNSanitizeEndToEnd(t *testing.T) {
 		t.Fatal("DNSanitize did not finish within expected time")
 	}
 }
+
+// TestDNSanitizeSingleJob checks that instant answers with a single job
+// slot never stall the scheduler (a worker releases its slot only after
+// its result was received).
+func TestDNSanitizeSingleJob(t *testing.T) {
+	t.Parallel()
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		return &dns.DNSAnswer{
+			Domain:        domain,
+			DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"},
+		}
+	})
+	ips := make([]string, 200)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("192.0.2.%d", i)
+	}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           ips,
+		Template:            dummyTemplate(),
+		MaxThreads:          1,
+		MaxPoolSize:         4,
+		GlobRateLimit:       100_000,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	done := make(chan struct{})
+	go func() {
+		DNSanitize(settings, st)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNSanitize stalled with a single job slot")
+	}
+	if st.ValidServers != len(ips) {
+		t.Fatalf("expected %d valid servers, got %d", len(ips), st.ValidServers)
+	}
+}
+
+// TestDNSanitizeMinScore checks that valid servers scoring below
+// PerSrvMinScore (here, a slow one) are dropped once finished.
+func TestDNSanitizeMinScore(t *testing.T) {
+	t.Parallel()
+	resolver := dns.ResolverFunc(func(
+		domain, server string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		if server == "192.0.2.2" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return &dns.DNSAnswer{
+			Domain:        domain,
+			DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"},
+		}
+	})
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           []string{"192.0.2.1", "192.0.2.2"},
+		Template:            dummyTemplate(),
+		MaxThreads:          2,
+		MaxPoolSize:         2,
+		GlobRateLimit:       50,
+		PerSrvRateLimit:     1,
+		PerSrvMinScore:      95,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	scores := map[string]float64{}
+	st.OnServerFinished = func(srv *dns.ServerContext) {
+		if !srv.Disabled {
+			scores[srv.IPAddress] = srv.Score()
+		}
+	}
+	DNSanitize(settings, st)
+	if len(scores) != 1 || scores["192.0.2.1"] < 95 {
+		t.Fatalf("expected only the fast server to be valid, got %v", scores)
+	}
+}
+
+// untestedRecorder is a StatusReporter recording untested servers.
+type untestedRecorder struct {
+	*report.StatusReporter
+	untested []string
+}
+
+func (r *untestedRecorder) ReportUntestedServer(srv *dns.ServerContext) {
+	r.untested = append(r.untested, srv.IPAddress)
+}
+
+// TestDNSanitizeContextInterrupted checks that a cancelled run returns
+// promptly, cancels in-flight queries, and reports unfinished servers
+// as untested (servers not loaded yet are left in the source).
+func TestDNSanitizeContextInterrupted(t *testing.T) {
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, ctx context.Context,
+	) *dns.DNSAnswer {
+		<-ctx.Done() // never answers unless cancelled
+		return &dns.DNSAnswer{
+			Domain:        domain,
+			DNSAnswerData: dns.DNSAnswerData{Status: "ERROR - canceled"},
+		}
+	})
+
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	source := config.NewServerSourceFromList(ips)
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerSource:        source,
+		Template:            dummyTemplate(),
+		MaxThreads:          2,
+		MaxPoolSize:         2,
+		GlobRateLimit:       50,
+		PerSrvRateLimit:     1,
+		PerSrvMaxFailures:   0,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := &untestedRecorder{StatusReporter: newStatus()}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		DNSanitizeContext(ctx, settings, st)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNSanitizeContext did not stop after cancellation")
+	}
+	if st.UntestedServers != 3 || st.ValidServers+st.InvalidServers != 0 {
+		t.Fatalf("expected 3 untested servers, got untested=%d valid=%d invalid=%d",
+			st.UntestedServers, st.ValidServers, st.InvalidServers)
+	}
+	for ip, ok := source.Next(); ok; ip, ok = source.Next() {
+		st.untested = append(st.untested, ip)
+	}
+	sort.Strings(st.untested)
+	if !reflect.DeepEqual(st.untested, ips) {
+		t.Fatalf("expected untested servers %v, got %v", ips, st.untested)
+	}
+}
+
+// TestDNSanitizeStreamedSource checks that servers read from a pipe
+// (total unknown until EOF) are all sanitized, duplicates only once,
+// and that the reported total is fixed at the end.
+func TestDNSanitizeStreamedSource(t *testing.T) {
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "NXDOMAIN"}}
+	})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	path := fmt.Sprintf("/dev/fd/%d", r.Fd())
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s not available: %v", path, err)
+	}
+	go func() {
+		for i := 1; i <= 50; i++ {
+			fmt.Fprintf(w, "192.0.2.%d\n192.0.2.%d\n", i, i) // with duplicates
+		}
+		w.Close()
+	}()
+	source, err := config.OpenServerSource(path, config.SourceOptions{
+		AllowSpecial: true, // documentation addresses
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+	}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerSource:        source,
+		Template:            tpl,
+		MaxThreads:          10,
+		MaxPoolSize:         5, // far less than the list
+		GlobRateLimit:       10_000,
+		PerSrvMaxFailures:   0,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := report.NewStatusReporter("test", &report.IOFiles{}, settings)
+	DNSanitize(settings, st)
+	st.Stop()
+	if st.ValidServers != 50 || st.TotalServers != 50 {
+		t.Fatalf("expected 50/50 valid servers, got %d/%d",
+			st.ValidServers, st.TotalServers)
+	}
+	if st.TotalChecks != 50 || st.DoneChecks != 50 {
+		t.Fatalf("expected 50/50 checks, got %d/%d", st.DoneChecks, st.TotalChecks)
+	}
+}
+
+// TestDNSanitizeStalledPipe checks that a pipe with no new server (but
+// not closed) doesn't block the scheduler: results are still collected,
+// and cancellation is honoured.
+func TestDNSanitizeStalledPipe(t *testing.T) {
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "NXDOMAIN"}}
+	})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close() // (never closed before the end of the run)
+	path := fmt.Sprintf("/dev/fd/%d", r.Fd())
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s not available: %v", path, err)
+	}
+	fmt.Fprintln(w, "192.0.2.1")
+	source, err := config.OpenServerSource(path, config.SourceOptions{
+		AllowSpecial: true, // documentation addresses
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+	}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerSource:        source,
+		Template:            tpl,
+		MaxThreads:          10,
+		MaxPoolSize:         5,
+		GlobRateLimit:       10_000,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := report.NewStatusReporter("test", &report.IOFiles{}, settings)
+	finished := make(chan string, 1)
+	st.OnServerFinished = func(srv *dns.ServerContext) {
+		finished <- srv.IPAddress
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		DNSanitizeContext(ctx, settings, st)
+		close(done)
+	}()
+	select {
+	case ip := <-finished:
+		if ip != "192.0.2.1" {
+			t.Fatalf("unexpected finished server %s", ip)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("result not collected while waiting for the pipe")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNSanitizeContext ignored cancellation while waiting for the pipe")
+	}
+	st.Stop()
+}
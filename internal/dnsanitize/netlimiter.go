@@ -0,0 +1,106 @@
+package dnsanitize
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+// netLimiterSweepEvery is the number of Consume() calls between two
+// sweeps of expired networks (bounds memory on huge lists).
+const netLimiterSweepEvery = 4096
+
+// netKey identifies a rate-limited network: a prefix, or an AS number.
+type netKey struct {
+	prefix netip.Prefix
+	asn    uint32
+}
+
+// NetLimiter enforces rate limits shared by every server of the same
+// network (/bits4 or /bits6 prefix) and, optionally, of the same AS.
+// It sits between the global RateLimiter and the per-server NextQueryAt.
+// All methods are single-goroutine – no mutex needed.
+type NetLimiter struct {
+	bits4, bits6 int
+	netInterval  time.Duration // min delay between 2 queries per prefix (0: off)
+	asnInterval  time.Duration // min delay between 2 queries per AS (0: off)
+	asnDB        *netutil.ASNDB
+	nextAt       map[netKey]time.Time // network ➜ next allowed query
+	calls        int                  // Consume() calls since last sweep
+}
+
+// NewNetLimiter returns a NetLimiter allowing netRate req/s per network
+// and asnRate req/s per AS (looked up in asnDB). A zero rate disables
+// the matching limit.
+func NewNetLimiter(
+	netRate float64,
+	bits4, bits6 int,
+	asnRate float64,
+	asnDB *netutil.ASNDB,
+) *NetLimiter {
+	interval := func(rate float64) time.Duration {
+		if rate <= 0 {
+			return 0
+		}
+		return time.Duration(float64(time.Second) / rate)
+	}
+	return &NetLimiter{
+		bits4:       bits4,
+		bits6:       bits6,
+		netInterval: interval(netRate),
+		asnInterval: interval(asnRate),
+		asnDB:       asnDB,
+		nextAt:      make(map[netKey]time.Time),
+	}
+}
+
+// keys returns the networks ip belongs to, with their interval.
+func (nl *NetLimiter) keys(ipStr string) (keys [2]netKey, intervals [2]time.Duration) {
+	addr, err := netutil.ParseServerAddr(ipStr)
+	if err != nil {
+		return keys, intervals
+	}
+	ip := addr.Addr()
+	if nl.netInterval > 0 {
+		if prefix, ok := netutil.NetworkOf(ip, nl.bits4, nl.bits6); ok {
+			keys[0], intervals[0] = netKey{prefix: prefix}, nl.netInterval
+		}
+	}
+	if nl.asnInterval > 0 {
+		if asn, ok := nl.asnDB.Lookup(ip); ok {
+			keys[1], intervals[1] = netKey{asn: asn}, nl.asnInterval
+		}
+	}
+	return keys, intervals
+}
+
+// NextAllowed returns when a server of this ip may be queried.
+// ok is true if it may be queried at `now`.
+func (nl *NetLimiter) NextAllowed(ipStr string, now time.Time) (at time.Time, ok bool) {
+	keys, intervals := nl.keys(ipStr)
+	for i, key := range keys {
+		if intervals[i] > 0 && nl.nextAt[key].After(at) {
+			at = nl.nextAt[key]
+		}
+	}
+	return at, !at.After(now)
+}
+
+// Consume records a query sent at `now` to a server of this ip.
+func (nl *NetLimiter) Consume(ipStr string, now time.Time) {
+	keys, intervals := nl.keys(ipStr)
+	for i, key := range keys {
+		if intervals[i] > 0 {
+			nl.nextAt[key] = now.Add(intervals[i])
+		}
+	}
+	if nl.calls++; nl.calls >= netLimiterSweepEvery {
+		nl.calls = 0
+		for key, at := range nl.nextAt {
+			if !at.After(now) {
+				delete(nl.nextAt, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package dnsanitize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+func TestNetLimiterPrefix(t *testing.T) {
+	nl := NewNetLimiter(10, 24, 48, 0, nil) // 100ms per network
+	now := time.Now()
+
+	if _, ok := nl.NextAllowed("192.0.2.1", now); !ok {
+		t.Fatal("fresh network must be allowed")
+	}
+	nl.Consume("192.0.2.1", now)
+	// same /24 -> denied until now+100ms
+	at, ok := nl.NextAllowed("192.0.2.200", now)
+	if ok || !at.Equal(now.Add(100*time.Millisecond)) {
+		t.Fatalf("same network: ok=%v at=%v, want denied until +100ms", ok, at.Sub(now))
+	}
+	if _, ok := nl.NextAllowed("192.0.2.200", now.Add(100*time.Millisecond)); !ok {
+		t.Fatal("network must be allowed again after its interval")
+	}
+	// other /24 and IPv6 are independent
+	if _, ok := nl.NextAllowed("192.0.3.1", now); !ok {
+		t.Fatal("other network must be allowed")
+	}
+	nl.Consume("2001:db8:1::1", now)
+	if _, ok := nl.NextAllowed("2001:db8:1:ffff::1", now); ok {
+		t.Fatal("same /48 must be denied")
+	}
+	if _, ok := nl.NextAllowed("2001:db8:2::1", now); !ok {
+		t.Fatal("other /48 must be allowed")
+	}
+}
+
+func TestNetLimiterASN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	db := "192.0.2.0/24 AS64500\n198.51.100.0/24 AS64500\n203.0.113.0/24 AS64501\n"
+	if err := os.WriteFile(path, []byte(db), 0644); err != nil {
+		t.Fatal(err)
+	}
+	asnDB, err := netutil.LoadASNDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nl := NewNetLimiter(0, 24, 48, 5, asnDB) // 200ms per AS, no prefix limit
+	now := time.Now()
+	nl.Consume("192.0.2.1", now)
+	if _, ok := nl.NextAllowed("198.51.100.1", now); ok {
+		t.Fatal("same AS must be denied")
+	}
+	if _, ok := nl.NextAllowed("203.0.113.1", now); !ok {
+		t.Fatal("other AS must be allowed")
+	}
+	if _, ok := nl.NextAllowed("10.0.0.1", now); !ok {
+		t.Fatal("unknown AS must not be limited")
+	}
+}
+
+func TestNetLimiterSweep(t *testing.T) {
+	nl := NewNetLimiter(1000, 32, 128, 0, nil)
+	now := time.Now()
+	for i, ip := range syntheticIPs(netLimiterSweepEvery) {
+		nl.Consume(ip, now.Add(time.Duration(i)*time.Second))
+	}
+	if len(nl.nextAt) > 2 {
+		t.Fatalf("expired networks must be swept, %d left", len(nl.nextAt))
+	}
+}
+
+// TestScheduleChecksNetLimit checks that servers of the same /24 never
+// get queries closer than the per-network interval.
+func TestScheduleChecksNetLimit(t *testing.T) {
+	var mu sync.Mutex
+	var sentAt []time.Time
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		mu.Lock()
+		sentAt = append(sentAt, time.Now())
+		mu.Unlock()
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "NXDOMAIN"}}
+	})
+
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "b.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+	}
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           ips,
+		Template:            tpl,
+		MaxThreads:          8,
+		MaxPoolSize:         4,
+		GlobRateLimit:       1000,
+		NetRateLimit:        25, // 40ms between 2 queries of the /24
+		NetPrefix4:          24,
+		NetPrefix6:          48,
+		PerSrvMaxFailures:   0,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	DNSanitize(settings, st)
+	if st.ValidServers != len(ips) {
+		t.Fatalf("expected %d valid servers, got %d", len(ips), st.ValidServers)
+	}
+	if len(sentAt) != len(ips)*len(tpl) {
+		t.Fatalf("expected %d queries, got %d", len(ips)*len(tpl), len(sentAt))
+	}
+	sort.Slice(sentAt, func(i, j int) bool { return sentAt[i].Before(sentAt[j]) })
+	for i := 1; i < len(sentAt); i++ {
+		// small margin: timestamps are taken inside the workers
+		if gap := sentAt[i].Sub(sentAt[i-1]); gap < 35*time.Millisecond {
+			t.Fatalf("queries %d and %d only %v apart", i-1, i, gap)
+		}
+	}
+}
@@ -18,6 +18,8 @@ type RateLimiter struct {
 	refillAmount   atomic.Uint64 // tokens added each interval
 	refillInterval time.Duration // interval between refills
 
+	refilled chan struct{} // notified (non-blocking) after each refill
+
 	startOnce sync.Once          // ensures StartRefiller is called only once
 	ctx       context.Context    // context for cancellation
 	cancel    context.CancelFunc // cancellation function
@@ -55,6 +57,7 @@ func NewRateLimiter(globalRateLimit int, burstTime time.Duration) *RateLimiter {
 	// build bucket
 	tb := &RateLimiter{
 		refillInterval: realInterval,
+		refilled:       make(chan struct{}, 1),
 		ctx:            ctx,
 		cancel:         cancel,
 	}
@@ -101,6 +104,10 @@ func (tb *RateLimiter) refillOnce() {
 			want = max
 		}
 		if tb.tokens.CompareAndSwap(old, want) {
+			select {
+			case tb.refilled <- struct{}{}:
+			default: // a notification is already pending
+			}
 			return
 		}
 		if spins >= maxSpins {
@@ -110,6 +117,12 @@ func (tb *RateLimiter) refillOnce() {
 	}
 }
 
+// Refilled returns a channel receiving a notification after refills,
+// allowing a consumer to sleep until tokens are available again.
+func (tb *RateLimiter) Refilled() <-chan struct{} {
+	return tb.refilled
+}
+
 // ConsumeOne attempts to remove one token. Returns true if successful.
 // This method is lock-free and non-blocking.
 func (tb *RateLimiter) ConsumeOne() bool {
@@ -155,3 +155,20 @@ func TestRateLimiterConcurrencySafety(t *testing.T) {
 		t.Fatalf("Remaining() after concurrent GiveBackOne = %d, want %d", rl.Remaining(), tokens)
 	}
 }
+
+func TestRateLimiterRefilledNotification(t *testing.T) {
+	t.Parallel()
+
+	rl := NewRateLimiter(100, 10*time.Millisecond)
+	defer rl.StopRefiller()
+	for rl.ConsumeOne() {
+	}
+	deadline := time.After(time.Second)
+	for rl.Remaining() == 0 { // skip notifications sent before drain
+		select {
+		case <-rl.Refilled():
+		case <-deadline:
+			t.Fatal("no refill notification received")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dnsanitize
+
+import (
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// Reporter receives the progress & results of a DNSanitize run.
+// It is implemented by report.StatusReporter (progress bar, output
+// files...), and by the public dnsanity package.
+// Methods are only called from the scheduler goroutine.
+type Reporter interface {
+	// AddTotalServers adds n servers to the total (known is false
+	// while the server source isn't fully read).
+	AddTotalServers(n int, known bool)
+	// AddDoneChecks adds done & total checks (total can be negative
+	// when a disabled server's pending checks are cancelled).
+	AddDoneChecks(addDoneChecks, addTotalChecks int)
+	// AddSavedQueries adds the queries saved by check ordering.
+	AddSavedQueries(n int)
+	// AddUntestedServers adds servers left unfinished by an interruption.
+	AddUntestedServers(n int)
+	// ReportUntestedServer is called once per server of the pool left
+	// unfinished by an interruption (servers not loaded yet are only
+	// counted by AddUntestedServers).
+	ReportUntestedServer(srv *dns.ServerContext)
+	// ReportFinishedServer is called once per finished server.
+	ReportFinishedServer(srv *dns.ServerContext)
+	// LogRequests logs the queries sent to idle & busy servers at t.
+	LogRequests(t time.Time, nIdle, nBusy int)
+	// UpdateBusyJobs sets the number of in-flight queries.
+	UpdateBusyJobs(n int)
+	// UpdatePoolSize sets the number of servers in the pool.
+	UpdatePoolSize(n int)
+	// Debug logs a debug message.
+	Debug(format string, args ...interface{})
+}
@@ -0,0 +1,85 @@
+package dnsanitize
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// StatusTruncated stands for a truncated NOERROR answer in retry policy
+// status lists.
+const StatusTruncated = "TC"
+
+// DefaultRetryOn are the statuses retried by default: transient errors,
+// and truncated answers.
+var DefaultRetryOn = []string{"TIMEOUT", "SERVFAIL", StatusTruncated}
+
+// maxBackoffShift caps the exponential backoff to 32 times its base.
+const maxBackoffShift = 5
+
+// RetryPolicy decides which failed checks are retried (and after which
+// delay), and which answers drop their server at once.
+// All methods are single-goroutine – no mutex needed.
+type RetryPolicy struct {
+	retryOn  map[string]bool // statuses worth a retry
+	fastFail map[string]bool // statuses dropping the server at once
+	backoff  time.Duration   // delay before 1st retry (0: none)
+}
+
+// NewRetryPolicy returns a RetryPolicy retrying retryOn statuses
+// (DefaultRetryOn if nil), after backoff, doubled on each new attempt
+// (with jitter), and dropping servers answering a fastFail status.
+func NewRetryPolicy(
+	retryOn, fastFail []string, backoff time.Duration,
+) *RetryPolicy {
+	if retryOn == nil {
+		retryOn = DefaultRetryOn
+	}
+	rp := &RetryPolicy{
+		retryOn:  make(map[string]bool, len(retryOn)),
+		fastFail: make(map[string]bool, len(fastFail)),
+		backoff:  backoff,
+	}
+	for _, status := range retryOn {
+		rp.retryOn[status] = true
+	}
+	for _, status := range fastFail {
+		rp.fastFail[status] = true
+	}
+	return rp
+}
+
+// DefaultRetryPolicy returns the policy of dns.DNSAnswer.IsWorthRetrying
+// (no backoff, no fast-fail).
+func DefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(nil, nil, 0)
+}
+
+// status returns the policy status of answer ("TC" if truncated).
+func (rp *RetryPolicy) status(answer *dns.DNSAnswer) string {
+	if answer.Status == "NOERROR" && answer.Truncated {
+		return StatusTruncated
+	}
+	return answer.Status
+}
+
+// ShouldRetry tells whether a failed check is worth another attempt.
+func (rp *RetryPolicy) ShouldRetry(answer *dns.DNSAnswer) bool {
+	return answer != nil && rp.retryOn[rp.status(answer)]
+}
+
+// IsFastFail tells whether answer drops its server at once.
+func (rp *RetryPolicy) IsFastFail(answer *dns.DNSAnswer) bool {
+	return answer != nil && rp.fastFail[rp.status(answer)]
+}
+
+// Delay returns the delay before retry number n (starting at 1): the
+// backoff doubled n-1 times, with jitter in [50%, 100%].
+func (rp *RetryPolicy) Delay(n int) time.Duration {
+	if rp.backoff <= 0 || n < 1 {
+		return 0
+	}
+	delay := rp.backoff << min(n-1, maxBackoffShift)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
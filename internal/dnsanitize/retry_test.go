@@ -0,0 +1,133 @@
+package dnsanitize
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+func TestRetryPolicyDefault(t *testing.T) {
+	rp := DefaultRetryPolicy()
+	for _, tc := range []struct {
+		status    string
+		truncated bool
+	}{
+		{"TIMEOUT", false}, {"SERVFAIL", false}, {"NOERROR", true},
+		{"NOERROR", false}, {"NXDOMAIN", false}, {"REFUSED", false},
+		{"ECONNREFUSED", false},
+	} {
+		answer := &dns.DNSAnswer{
+			DNSAnswerData: dns.DNSAnswerData{Status: tc.status},
+			Truncated:     tc.truncated,
+		}
+		if got, want := rp.ShouldRetry(answer), answer.IsWorthRetrying(); got != want {
+			t.Errorf("ShouldRetry(%s, TC=%v) = %v, want %v",
+				tc.status, tc.truncated, got, want)
+		}
+		if rp.IsFastFail(answer) {
+			t.Errorf("IsFastFail(%s) should be false by default", tc.status)
+		}
+	}
+	if d := rp.Delay(1); d != 0 {
+		t.Errorf("expected no backoff by default, got %v", d)
+	}
+}
+
+func TestRetryPolicyCustom(t *testing.T) {
+	rp := NewRetryPolicy(
+		[]string{"REFUSED"}, []string{"ECONNREFUSED"}, 100*time.Millisecond)
+	answer := func(status string) *dns.DNSAnswer {
+		return &dns.DNSAnswer{DNSAnswerData: dns.DNSAnswerData{Status: status}}
+	}
+	if !rp.ShouldRetry(answer("REFUSED")) || rp.ShouldRetry(answer("TIMEOUT")) {
+		t.Errorf("expected only REFUSED to be retried")
+	}
+	if !rp.IsFastFail(answer("ECONNREFUSED")) || rp.IsFastFail(answer("REFUSED")) {
+		t.Errorf("expected only ECONNREFUSED to fast-fail")
+	}
+	for n, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		9: 3200 * time.Millisecond, // capped
+	} {
+		for i := 0; i < 20; i++ {
+			if d := rp.Delay(n); d < want/2 || d > want {
+				t.Fatalf("Delay(%d) = %v, want in [%v, %v]", n, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestApplyResultsRetryPolicy(t *testing.T) {
+	st := newStatus()
+	rp := NewRetryPolicy(nil, []string{"ECONNREFUSED"}, time.Second)
+	res := WorkerResult{Answer: &dns.DNSAnswer{
+		DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"}}}
+
+	// retry is delayed by backoff
+	srv := helperServer(3)
+	before := time.Now()
+	applyResults(srv, &res, rp, 5, st)
+	if len(srv.PendingChecks) != 1 || !srv.NextQueryAt.After(before.Add(400*time.Millisecond)) {
+		t.Fatalf("expected a delayed retry, got pending=%v next in %v",
+			srv.PendingChecks, srv.NextQueryAt.Sub(before))
+	}
+
+	// fast-fail drops the server at once, despite attempts & max failures
+	srv = helperServer(3)
+	res.Answer.Status = "ECONNREFUSED"
+	applyResults(srv, &res, rp, 5, st)
+	if !srv.Disabled || len(srv.PendingChecks) != 0 || srv.FailedCount != 1 {
+		t.Fatalf("expected server to be dropped at once, got disabled=%v pending=%v",
+			srv.Disabled, srv.PendingChecks)
+	}
+}
+
+// TestScheduleChecksRetryBackoff checks that the scheduler waits for the
+// retry backoff, not only for the per-server rate limit interval (the
+// server is still queued for its other pending check).
+func TestScheduleChecksRetryBackoff(t *testing.T) {
+	var mu sync.Mutex
+	times := make(map[string][]time.Time) // domain ➜ attempts
+	resolver := dns.ResolverFunc(func(
+		domain, _ string, _ time.Duration, _ context.Context,
+	) *dns.DNSAnswer {
+		mu.Lock()
+		times[domain] = append(times[domain], time.Now())
+		mu.Unlock()
+		return &dns.DNSAnswer{
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"}}
+	})
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           []string{"192.0.2.1"},
+		Template:            nxdomainTemplate(2),
+		MaxThreads:          1,
+		MaxPoolSize:         1,
+		GlobRateLimit:       100,
+		PerSrvRateLimit:     10, // 100ms between queries
+		PerSrvMaxFailures:   2,
+		PerCheckMaxAttempts: 3,
+		PerQueryTimeout:     1,
+		RetryBackoff:        400 * time.Millisecond,
+	}
+	DNSanitize(settings, newStatus())
+
+	for domain, attempts := range times {
+		if len(attempts) != 3 {
+			t.Fatalf("%s: expected 3 attempts, got %d", domain, len(attempts))
+		}
+		// backoff of retry n is in [50%, 100%] of 400ms << (n-1)
+		for i, minGap := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond} {
+			if gap := attempts[i+1].Sub(attempts[i]); gap < minGap-10*time.Millisecond {
+				t.Errorf("%s: retry %d sent %v after previous attempt, want >= %v",
+					domain, i+1, gap, minGap)
+			}
+		}
+	}
+}
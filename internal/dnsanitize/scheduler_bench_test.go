@@ -0,0 +1,111 @@
+package dnsanitize
+
+import (
+	"context"
+	"math/rand"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// simulatedResolver answers every query like a healthy resolver would,
+// after a random delay in [0, maxLatency).
+func simulatedResolver(maxLatency time.Duration) func(
+	string, string, time.Duration, context.Context) *dns.DNSAnswer {
+	return func(domain, _ string, _ time.Duration, ctx context.Context) *dns.DNSAnswer {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(maxLatency)))):
+			return &dns.DNSAnswer{
+				Domain:        domain,
+				DNSAnswerData: dns.DNSAnswerData{Status: "NXDOMAIN"},
+			}
+		case <-ctx.Done():
+			return &dns.DNSAnswer{
+				Domain:        domain,
+				DNSAnswerData: dns.DNSAnswerData{Status: "ERROR - canceled"},
+			}
+		}
+	}
+}
+
+// cpuSeconds returns the CPU time spent so far running Go code and GC.
+func cpuSeconds() float64 {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/user:cpu-seconds"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	total := 0.0
+	for _, sample := range samples {
+		if sample.Value.Kind() == metrics.KindFloat64 {
+			total += sample.Value.Float64()
+		}
+	}
+	return total
+}
+
+// benchmarkScheduler runs DNSanitize over numServers simulated resolvers,
+// each answering 4 checks, with a low per-server rate limit so that most
+// of the pool is waiting on NextQueryAt at any time.
+func benchmarkScheduler(b *testing.B, numServers int) {
+	resolver := dns.ResolverFunc(simulatedResolver(5 * time.Millisecond))
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           syntheticIPs(numServers),
+		Template:            nxdomainTemplate(4),
+		MaxThreads:          numServers,
+		MaxPoolSize:         numServers,
+		GlobRateLimit:       100_000,
+		PerSrvRateLimit:     2,
+		PerSrvMaxFailures:   0,
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	cpuStart := cpuSeconds()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DNSanitize(settings, newStatus())
+	}
+	b.StopTimer()
+	b.ReportMetric((cpuSeconds()-cpuStart)/float64(b.N), "cpu-s/op")
+}
+
+func BenchmarkScheduler_1kServers(b *testing.B)  { benchmarkScheduler(b, 1_000) }
+func BenchmarkScheduler_20kServers(b *testing.B) { benchmarkScheduler(b, 20_000) }
+
+// TestScheduleChecksSimulated runs the scheduler over simulated resolvers
+// and checks every server gets fully tested.
+func TestScheduleChecksSimulated(t *testing.T) {
+	resolver := dns.ResolverFunc(simulatedResolver(2 * time.Millisecond))
+
+	tpl := dns.Template{
+		{Domain: "a.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "b.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NXDOMAIN"}}},
+		{Domain: "c.invalid", ValidAnswers: []dns.DNSAnswerData{{Status: "NOERROR"}}},
+	}
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5"}
+	settings := &config.Settings{
+		Resolver:            resolver,
+		ServerIPs:           ips,
+		Template:            tpl,
+		MaxThreads:          3,
+		MaxPoolSize:         2,
+		GlobRateLimit:       20,
+		PerSrvRateLimit:     50,
+		PerSrvMaxFailures:   2, // c.invalid fails, but srv is kept
+		PerCheckMaxAttempts: 1,
+		PerQueryTimeout:     1,
+	}
+	st := newStatus()
+	DNSanitize(settings, st)
+	if st.ValidServers != len(ips) || st.ServersWithFailures != len(ips) {
+		t.Fatalf("expected %d valid servers with failures, got valid=%d withFailures=%d",
+			len(ips), st.ValidServers, st.ServersWithFailures)
+	}
+	if st.Requests.Total() != len(ips)*len(tpl) {
+		t.Fatalf("expected %d requests, got %d", len(ips)*len(tpl), st.Requests.Total())
+	}
+}
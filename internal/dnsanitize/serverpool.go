@@ -1,6 +1,7 @@
 package dnsanitize
 
 import (
+	"github.com/nil0x42/dnsanity/internal/config"
 	"github.com/nil0x42/dnsanity/internal/dns"
 )
 
@@ -9,8 +10,9 @@ import (
 type ServerPool struct {
 	template dns.Template // checks
 
-	queue      []string // IPs still to load
-	dequeueIdx int      // next server idx to dequeue
+	source  *config.ServerSource // IPs still to load (read lazily)
+	next    string               // next IP to load (peeked from source)
+	hasNext bool                 // next is set
 
 	pool      map[int]*dns.ServerContext // srvID ➜ *ServerContext
 	nextSlot  int                        // srvID generator
@@ -24,13 +26,13 @@ type ServerPool struct {
 // NewServerPool
 func NewServerPool(
 	maxPoolSz int,
-	serverIPs []string,
+	source *config.ServerSource,
 	template dns.Template,
 	maxAttempts int,
 ) *ServerPool {
 	sp := &ServerPool{
 		template:    template,
-		queue:       serverIPs,
+		source:      source,
 		pool:        make(map[int]*dns.ServerContext),
 		maxPoolSz:   maxPoolSz,
 		maxAttempts: maxAttempts,
@@ -41,17 +43,16 @@ func NewServerPool(
 /* public API ------------------------------------------------------------- */
 
 // LoadN loads up to n ServerContexts into the pool, expanding it as needed.
-// Returns the number of ServerContexts inserted.
-func (sp *ServerPool) LoadN(n int) int {
-	inserted := 0
-	for inserted < n && !sp.IsFull() && sp.NumPending() > 0 {
-		ip := sp.queue[sp.dequeueIdx]
-		sp.dequeueIdx++
+// Returns the slots of inserted ServerContexts.
+func (sp *ServerPool) LoadN(n int) []int {
+	var inserted []int
+	for len(inserted) < n && !sp.IsFull() && sp.HasPending() {
+		sp.hasNext = false
 		sp.pool[sp.nextSlot] = dns.NewServerContext(
-			ip, sp.template, sp.maxAttempts,
+			sp.next, sp.template, sp.maxAttempts,
 		)
+		inserted = append(inserted, sp.nextSlot)
 		sp.nextSlot++
-		inserted++
 	}
 	return inserted
 }
@@ -67,19 +68,67 @@ func (sp *ServerPool) Unload(slot int) {
 	delete(sp.pool, slot)
 }
 
+// UnloadAll empties the pool, and returns the unloaded servers.
+func (sp *ServerPool) UnloadAll() []*dns.ServerContext {
+	servers := make([]*dns.ServerContext, 0, len(sp.pool))
+	for slot, srv := range sp.pool {
+		servers = append(servers, srv)
+		delete(sp.pool, slot)
+	}
+	return servers
+}
+
 // Len returns current servers loaded in pool
 func (sp *ServerPool) Len() int {
 	return len(sp.pool)
 }
 
-// NumPending tells how many servers must still be sent to queue
+// HasPending tells if a server can be loaded from the source now (never
+// waits for a pipe, see Ready())
+func (sp *ServerPool) HasPending() bool {
+	if !sp.hasNext {
+		sp.next, sp.hasNext = sp.source.TryNext()
+	}
+	return sp.hasNext
+}
+
+// Ready returns a channel signaled when servers may be loaded again, if
+// the pool waits for the source (a pipe) to read them, else nil.
+func (sp *ServerPool) Ready() <-chan struct{} {
+	if sp.IsFull() || sp.HasPending() || sp.source.Exhausted() {
+		return nil
+	}
+	return sp.source.Ready()
+}
+
+// NumPending tells how many servers must still be loaded (0 if unknown)
 func (sp *ServerPool) NumPending() int {
-	return len(sp.queue) - sp.dequeueIdx
+	n := sp.source.Remaining()
+	if sp.hasNext {
+		n++ // peeked server, already read from source
+	}
+	return n
+}
+
+// Release gives the peeked server back to the source, so that it can
+// still be read from it once the pool isn't used anymore.
+func (sp *ServerPool) Release() {
+	if sp.hasNext {
+		sp.source.Unread(sp.next)
+		sp.hasNext = false
+	}
+}
+
+// TotalServers returns the number of servers to sanitize (servers read
+// so far if the source can't tell before EOF).
+func (sp *ServerPool) TotalServers() int {
+	total, _ := sp.source.Total()
+	return total
 }
 
 // IsDrained is true when no server remains and queue is empty.
 func (sp *ServerPool) IsDrained() bool {
-	return sp.Len() == 0 && sp.NumPending() == 0
+	return sp.Len() == 0 && !sp.HasPending() && sp.source.Exhausted()
 }
 
 func (sp *ServerPool) MaxSize() int {
@@ -92,5 +141,5 @@ func (sp *ServerPool) IsFull() bool {
 }
 
 func (sp *ServerPool) CanGrow() bool {
-	return !sp.IsFull() && sp.NumPending() > 0
+	return !sp.IsFull() && sp.HasPending()
 }
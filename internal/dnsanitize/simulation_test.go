@@ -0,0 +1,278 @@
+package dnsanitize
+
+import (
+	"context"
+	"flag"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// Scheduler simulation: DNSanitize runs against a synthetic population
+// of resolvers, to measure the effect of -threads, -max-poolsize and
+// -global-ratelimit (or of scheduler changes) without any network:
+//
+//	go test ./internal/dnsanitize -run '^$' -bench Simulation \
+//	    -sim.servers 200000 -sim.threads 20000 -sim.ratelimit 50000 \
+//	    -sim.population dead-heavy
+//
+// -sim.population picks one of simPopulations ("": all of them).
+
+var (
+	simServers   = flag.Int("sim.servers", 100_000, "simulated servers")
+	simThreads   = flag.Int("sim.threads", 10_000, "simulated -threads")
+	simPoolSize  = flag.Int("sim.poolsize", 20_000, "simulated -max-poolsize")
+	simRateLimit = flag.Int("sim.ratelimit", 50_000, "simulated -global-ratelimit")
+	simPopName   = flag.String("sim.population", "realistic", "simulated population (\"\": all)")
+)
+
+// simClass is a kind of resolver of the population.
+type simClass struct {
+	Weight     float64       // share of the population
+	LatencyMin time.Duration // answers take [LatencyMin, LatencyMax)
+	LatencyMax time.Duration
+	Loss       float64 // probability of an unanswered query (TIMEOUT)
+	Status     string  // answer status ("": correct answer)
+}
+
+// simPopulation is a mix of resolver classes.
+type simPopulation []simClass
+
+// simPopulations are the named populations of BenchmarkSimulation.
+var simPopulations = map[string]simPopulation{
+	// roughly looks like a public resolvers list
+	"realistic": {
+		{Weight: 0.55, LatencyMin: 10 * time.Millisecond, LatencyMax: 80 * time.Millisecond, Loss: 0.01},
+		{Weight: 0.15, LatencyMin: 100 * time.Millisecond, LatencyMax: 600 * time.Millisecond, Loss: 0.05},
+		{Weight: 0.15, Loss: 1}, // dead
+		{Weight: 0.10, LatencyMin: 10 * time.Millisecond, LatencyMax: 80 * time.Millisecond, Status: "NOERROR"}, // lying
+		{Weight: 0.05, LatencyMin: 5 * time.Millisecond, LatencyMax: 20 * time.Millisecond, Status: "REFUSED"},
+	},
+	// fast and correct resolvers only: bound by the rate limits
+	"healthy": {
+		{Weight: 1, LatencyMin: 10 * time.Millisecond, LatencyMax: 80 * time.Millisecond},
+	},
+	// mostly unreachable resolvers (e.g. a stale list): bound by timeouts
+	"dead-heavy": {
+		{Weight: 0.20, LatencyMin: 10 * time.Millisecond, LatencyMax: 80 * time.Millisecond, Loss: 0.01},
+		{Weight: 0.80, Loss: 1},
+	},
+	// slow and lossy resolvers: bound by retries
+	"lossy": {
+		{Weight: 0.50, LatencyMin: 200 * time.Millisecond, LatencyMax: 900 * time.Millisecond, Loss: 0.30},
+		{Weight: 0.50, LatencyMin: 10 * time.Millisecond, LatencyMax: 80 * time.Millisecond, Loss: 0.10},
+	},
+}
+
+// resolver returns numServers server IPs, and a Resolver simulating them
+// (each server is given a class at random, following weights).
+func (pop simPopulation) resolver(numServers int) ([]string, dns.Resolver) {
+	rng := rand.New(rand.NewSource(42))
+	total := 0.0
+	for _, class := range pop {
+		total += class.Weight
+	}
+	ips := syntheticIPs(numServers)
+	classes := make(map[string]*simClass, numServers)
+	for i := range ips {
+		pick := rng.Float64() * total
+		for j := range pop {
+			if pick -= pop[j].Weight; pick < 0 || j == len(pop)-1 {
+				classes[ips[i]] = &pop[j]
+				break
+			}
+		}
+	}
+	resolver := dns.ResolverFunc(func(
+		domain, server string, timeout time.Duration, ctx context.Context,
+	) *dns.DNSAnswer {
+		class := classes[server] // read-only: safe for concurrent use
+		answer := &dns.DNSAnswer{Domain: domain}
+		delay := class.LatencyMin
+		if class.LatencyMax > class.LatencyMin {
+			delay += time.Duration(rand.Int63n(int64(class.LatencyMax - class.LatencyMin)))
+		}
+		answer.Status = "NXDOMAIN"
+		if rand.Float64() < class.Loss {
+			delay, answer.Status = timeout, "TIMEOUT"
+		} else if class.Status != "" {
+			answer.Status = class.Status
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			answer.Status = "ERROR - canceled"
+		}
+		return answer
+	})
+	return ips, resolver
+}
+
+// simStats are the measures of a simulation.
+type simStats struct {
+	Wall     time.Duration
+	Servers  int     // finished servers
+	Valid    int     // valid servers
+	Requests int     // sent queries
+	PoolUtil float64 // mean pool size / MaxPoolSize
+	BusyUtil float64 // mean in-flight queries / MaxThreads
+}
+
+// Throughput returns the finished servers per second.
+func (st simStats) Throughput() float64 {
+	return float64(st.Servers) / st.Wall.Seconds()
+}
+
+// RPS returns the achieved queries per second.
+func (st simStats) RPS() float64 {
+	return float64(st.Requests) / st.Wall.Seconds()
+}
+
+// simReporter is a Reporter collecting simStats.
+// All methods are single-goroutine – no mutex needed.
+type simReporter struct {
+	stats    simStats
+	start    time.Time
+	last     time.Time // last pool size or busy jobs update
+	poolSize int
+	busyJobs int
+	poolArea float64 // integral of poolSize over time (seconds)
+	busyArea float64 // integral of busyJobs over time (seconds)
+}
+
+func (r *simReporter) advance() {
+	now := time.Now()
+	dt := now.Sub(r.last).Seconds()
+	r.poolArea += float64(r.poolSize) * dt
+	r.busyArea += float64(r.busyJobs) * dt
+	r.last = now
+}
+
+func (r *simReporter) AddTotalServers(int, bool)               {}
+func (r *simReporter) AddDoneChecks(int, int)                  {}
+func (r *simReporter) AddSavedQueries(int)                     {}
+func (r *simReporter) AddUntestedServers(int)                  {}
+func (r *simReporter) ReportUntestedServer(*dns.ServerContext) {}
+func (r *simReporter) Debug(string, ...interface{})            {}
+
+func (r *simReporter) ReportFinishedServer(srv *dns.ServerContext) {
+	r.stats.Servers++
+	if !srv.Disabled {
+		r.stats.Valid++
+	}
+}
+
+func (r *simReporter) LogRequests(_ time.Time, nIdle, nBusy int) {
+	r.stats.Requests += nIdle + nBusy
+}
+
+func (r *simReporter) UpdateBusyJobs(n int) {
+	r.advance()
+	r.busyJobs = n
+}
+
+func (r *simReporter) UpdatePoolSize(n int) {
+	r.advance()
+	r.poolSize = n
+}
+
+// runSimulation runs DNSanitize with settings against numServers
+// resolvers of pop.
+func runSimulation(
+	pop simPopulation, numServers int, settings config.Settings,
+) simStats {
+	settings.ServerIPs, settings.Resolver = pop.resolver(numServers)
+	r := &simReporter{start: time.Now()}
+	r.last = r.start
+	DNSanitize(&settings, r)
+	r.advance()
+	r.stats.Wall = time.Since(r.start)
+	secs := r.stats.Wall.Seconds()
+	r.stats.PoolUtil = r.poolArea / secs / float64(settings.MaxPoolSize)
+	r.stats.BusyUtil = r.busyArea / secs / float64(settings.MaxThreads)
+	return r.stats
+}
+
+// simSettings returns settings close to the CLI defaults.
+func simSettings(threads, poolSize, globRateLimit int) config.Settings {
+	return config.Settings{
+		Template:            nxdomainTemplate(4),
+		MaxThreads:          threads,
+		MaxPoolSize:         poolSize,
+		GlobRateLimit:       globRateLimit,
+		PerSrvRateLimit:     2,
+		PerSrvMaxFailures:   0,
+		PerCheckMaxAttempts: 2,
+		PerQueryTimeout:     1,
+	}
+}
+
+func BenchmarkSimulation(b *testing.B) {
+	names := []string{*simPopName}
+	if *simPopName == "" {
+		names = slices.Sorted(maps.Keys(simPopulations))
+	} else if _, ok := simPopulations[*simPopName]; !ok {
+		b.Fatalf("-sim.population: unknown %q, want one of %v",
+			*simPopName, slices.Sorted(maps.Keys(simPopulations)))
+	}
+	for _, name := range names {
+		b.Run(name, func(b *testing.B) {
+			benchmarkSimulation(b, simPopulations[name])
+		})
+	}
+}
+
+// benchmarkSimulation runs the simulation of pop, with the -sim.* flags.
+func benchmarkSimulation(b *testing.B, pop simPopulation) {
+	settings := simSettings(*simThreads, *simPoolSize, *simRateLimit)
+	var st simStats
+	for i := 0; i < b.N; i++ {
+		st = runSimulation(pop, *simServers, settings)
+	}
+	b.ReportMetric(st.Wall.Seconds(), "wall-s")
+	b.ReportMetric(st.Throughput(), "srv/s")
+	b.ReportMetric(st.RPS(), "req/s")
+	b.ReportMetric(st.RPS()/float64(settings.GlobRateLimit), "rps/limit")
+	b.ReportMetric(st.PoolUtil, "pool-util")
+	b.ReportMetric(st.BusyUtil, "busy-util")
+}
+
+// TestSimulation runs a small simulation, and checks its measures.
+func TestSimulation(t *testing.T) {
+	pop := simPopulation{
+		{Weight: 0.8, LatencyMax: 5 * time.Millisecond},
+		{Weight: 0.2, LatencyMax: 5 * time.Millisecond, Status: "REFUSED"},
+	}
+	settings := simSettings(200, 400, 2_000)
+	settings.PerSrvRateLimit = 50
+	st := runSimulation(pop, 1_000, settings)
+	t.Logf("%+v srv/s=%.0f req/s=%.0f", st, st.Throughput(), st.RPS())
+
+	if st.Servers != 1_000 {
+		t.Errorf("expected 1000 finished servers, got %d", st.Servers)
+	}
+	if st.Valid < 700 || st.Valid > 900 {
+		t.Errorf("expected ~800 valid servers, got %d", st.Valid)
+	}
+	if st.Requests < st.Valid*len(settings.Template) {
+		t.Errorf("expected at least %d requests, got %d",
+			st.Valid*len(settings.Template), st.Requests)
+	}
+	// the global RateLimiter starts full: allow 1s of burst
+	maxRequests := float64(settings.GlobRateLimit) * (st.Wall.Seconds() + 1)
+	if float64(st.Requests) > maxRequests {
+		t.Errorf("sent %d requests in %s, above -global-ratelimit %d",
+			st.Requests, st.Wall, settings.GlobRateLimit)
+	}
+	for name, util := range map[string]float64{
+		"pool": st.PoolUtil, "busy": st.BusyUtil} {
+		if util <= 0 || util > 1 {
+			t.Errorf("%s utilization out of (0, 1]: %f", name, util)
+		}
+	}
+}
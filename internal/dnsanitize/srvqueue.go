@@ -0,0 +1,90 @@
+package dnsanitize
+
+import (
+	"container/heap"
+	"time"
+)
+
+// srvQueueItem is a server waiting for its NextQueryAt deadline.
+type srvQueueItem struct {
+	at    time.Time // earliest time the server may be queried
+	srvID int       // server ID (in pool)
+}
+
+// srvHeap implements heap.Interface, ordered by deadline.
+type srvHeap []srvQueueItem
+
+func (h srvHeap) Len() int           { return len(h) }
+func (h srvHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h srvHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *srvHeap) Push(x any)        { *h = append(*h, x.(srvQueueItem)) }
+func (h *srvHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// SrvQueue is a min-heap of servers having pending checks, keyed by
+// their NextQueryAt deadline. Each server is queued at most once.
+// All methods are single-goroutine – no mutex needed.
+type SrvQueue struct {
+	items  srvHeap
+	parked []int        // ready servers set aside by Park()
+	queued map[int]bool // srvID ➜ currently queued (or parked)
+}
+
+// NewSrvQueue returns an empty SrvQueue
+func NewSrvQueue() *SrvQueue {
+	return &SrvQueue{queued: make(map[int]bool)}
+}
+
+// Push queues srvID until `at`. Returns false if it was already queued.
+func (q *SrvQueue) Push(srvID int, at time.Time) bool {
+	if q.queued[srvID] {
+		return false
+	}
+	q.queued[srvID] = true
+	heap.Push(&q.items, srvQueueItem{at: at, srvID: srvID})
+	return true
+}
+
+// PopReady dequeues the server with the earliest deadline if it is due
+// at `now`. ok is false if no server is ready.
+func (q *SrvQueue) PopReady(now time.Time) (srvID int, ok bool) {
+	if len(q.items) == 0 || q.items[0].at.After(now) {
+		return 0, false
+	}
+	item := heap.Pop(&q.items).(srvQueueItem)
+	delete(q.queued, item.srvID)
+	return item.srvID, true
+}
+
+// Park sets aside a ready server which can't be scheduled right now.
+// It stays queued, but is ignored by PopReady() and NextDeadline()
+// until UnparkAll() is called.
+func (q *SrvQueue) Park(srvID int) {
+	q.queued[srvID] = true
+	q.parked = append(q.parked, srvID)
+}
+
+// UnparkAll puts back every parked server as ready.
+func (q *SrvQueue) UnparkAll() {
+	for _, srvID := range q.parked {
+		heap.Push(&q.items, srvQueueItem{srvID: srvID})
+	}
+	q.parked = q.parked[:0]
+}
+
+// NextDeadline returns the earliest deadline. ok is false if empty.
+func (q *SrvQueue) NextDeadline() (at time.Time, ok bool) {
+	if len(q.items) == 0 {
+		return time.Time{}, false
+	}
+	return q.items[0].at, true
+}
+
+// Len returns the number of queued servers (parked ones included)
+func (q *SrvQueue) Len() int {
+	return len(q.items) + len(q.parked)
+}
@@ -0,0 +1,59 @@
+package dnsanitize
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSrvQueueOrdering(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	q := NewSrvQueue()
+	q.Push(1, now.Add(30*time.Millisecond))
+	q.Push(2, now.Add(-time.Second))
+	q.Push(3, now)
+	if q.Push(3, now) {
+		t.Fatal("a server must never be queued twice")
+	}
+	if at, ok := q.NextDeadline(); !ok || !at.Equal(now.Add(-time.Second)) {
+		t.Fatalf("NextDeadline() = %v, %v", at, ok)
+	}
+	for _, want := range []int{2, 3} {
+		if got, ok := q.PopReady(now); !ok || got != want {
+			t.Fatalf("PopReady() = %d, %v; want %d", got, ok, want)
+		}
+	}
+	if _, ok := q.PopReady(now); ok {
+		t.Fatal("server 1 is not ready yet")
+	}
+	if got, ok := q.PopReady(now.Add(time.Second)); !ok || got != 1 {
+		t.Fatalf("PopReady() = %d, %v; want 1", got, ok)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("queue should be empty, Len()=%d", q.Len())
+	}
+	if _, ok := q.NextDeadline(); ok {
+		t.Fatal("empty queue has no deadline")
+	}
+}
+
+func TestSrvQueueParking(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	q := NewSrvQueue()
+	q.Push(7, now)
+	srvID, _ := q.PopReady(now)
+	q.Park(srvID)
+	if q.Push(7, now) {
+		t.Fatal("a parked server is still queued")
+	}
+	if _, ok := q.NextDeadline(); ok || q.Len() != 1 {
+		t.Fatal("parked servers must be ignored by NextDeadline() but counted by Len()")
+	}
+	q.UnparkAll()
+	if got, ok := q.PopReady(now); !ok || got != 7 {
+		t.Fatalf("PopReady() after UnparkAll() = %d, %v", got, ok)
+	}
+}
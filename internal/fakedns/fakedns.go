@@ -0,0 +1,229 @@
+// Package fakedns runs scriptable DNS servers on loopback addresses, so
+// that the whole dnsanity pipeline can be tested without network access.
+//
+// Every server answers from the same Zone (the "truth"), and follows its
+// own Script to lie, drop, delay, refuse or truncate answers.
+package fakedns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/dnsutil"
+	"codeberg.org/miekg/dns/rdata"
+)
+
+// Records are the true records of a domain.
+type Records struct {
+	A     []string
+	CNAME []string
+}
+
+// Zone holds the records of every existing domain (lowercase, without
+// trailing dot). Other domains are NXDOMAIN.
+type Zone map[string]Records
+
+// Script tells how a Server answers A queries. The zero Script answers
+// correctly.
+type Script struct {
+	Hijack      string        // answer every query with this A record
+	NXRedirect  string        // answer NXDOMAIN queries with this A record
+	Drop        bool          // never answer
+	Delay       time.Duration // wait before answering
+	RefuseAfter int           // answer REFUSED after N queries (0: never)
+	Truncate    bool          // set TC on UDP answers (full answers on TCP)
+}
+
+// Server is a fake DNS server, listening on UDP & TCP.
+type Server struct {
+	Addr    string // "ip:port"
+	zone    Zone
+	script  Script
+	udp     net.PacketConn
+	tcp     net.Listener
+	queries atomic.Int64
+	wg      sync.WaitGroup
+}
+
+// Start starts a Server on ip (random port), answering from zone and
+// following script.
+func Start(ip string, zone Zone, script Script) (*Server, error) {
+	udp, err := net.ListenPacket("udp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		return nil, err
+	}
+	// same port on TCP (for truncated answers)
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	s := &Server{
+		Addr:   udp.LocalAddr().String(),
+		zone:   zone,
+		script: script,
+		udp:    udp,
+		tcp:    tcp,
+	}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, nil
+}
+
+// Queries returns the number of queries received so far.
+func (s *Server) Queries() int {
+	return int(s.queries.Load())
+}
+
+// Close stops the server, and waits for its goroutines.
+func (s *Server) Close() error {
+	err := s.udp.Close()
+	s.tcp.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	for {
+		buf := make([]byte, 65535)
+		n, from, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return // closed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if resp := s.answer(buf[:n], true); resp != nil {
+				s.udp.WriteTo(resp, from)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return // closed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5*time.Second + s.script.Delay))
+			var size uint16
+			if binary.Read(conn, binary.BigEndian, &size) != nil {
+				return
+			}
+			query := make([]byte, size)
+			if _, err := io.ReadFull(conn, query); err != nil {
+				return
+			}
+			if resp := s.answer(query, false); resp != nil {
+				binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+				conn.Write(resp)
+			}
+		}()
+	}
+}
+
+// answer returns the packed answer to a packed query (nil: no answer).
+func (s *Server) answer(query []byte, udp bool) []byte {
+	req := &dns.Msg{Data: query}
+	if req.Unpack() != nil || len(req.Question) != 1 {
+		return nil
+	}
+	count := int(s.queries.Add(1))
+	if s.script.Drop {
+		return nil
+	}
+	time.Sleep(s.script.Delay)
+
+	resp := dnsutil.SetReply(new(dns.Msg), req)
+	resp.RecursionAvailable = true
+	name, qtype := dnsutil.Question(req)
+	domain := strings.TrimSuffix(strings.ToLower(name), ".")
+	records, exists := s.zone[domain]
+	switch {
+	case s.script.RefuseAfter > 0 && count > s.script.RefuseAfter:
+		resp.Rcode = dns.RcodeRefused
+	case udp && s.script.Truncate:
+		resp.Truncated = true
+	case s.script.Hijack != "":
+		records = Records{A: []string{s.script.Hijack}}
+	case !exists && s.script.NXRedirect != "":
+		records = Records{A: []string{s.script.NXRedirect}}
+	case !exists:
+		resp.Rcode = dns.RcodeNameError
+	}
+	if resp.Rcode == dns.RcodeSuccess && !resp.Truncated && qtype == dns.TypeA {
+		hdr := dns.Header{Name: name, Class: dns.ClassINET, TTL: 60}
+		for _, cname := range records.CNAME {
+			resp.Answer = append(resp.Answer,
+				&dns.CNAME{Hdr: hdr, CNAME: rdata.CNAME{Target: dnsutil.Fqdn(cname)}})
+		}
+		for _, a := range records.A {
+			addr, err := netip.ParseAddr(a)
+			if err != nil {
+				continue
+			}
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: rdata.A{Addr: addr}})
+		}
+	}
+	if resp.Pack() != nil {
+		return nil
+	}
+	return resp.Data
+}
+
+// Farm is a set of Servers sharing the same Zone.
+type Farm struct {
+	Servers []*Server
+}
+
+// StartFarm starts one Server per script, each on its own loopback
+// address (127.0.0.2, 127.0.0.3...) where supported, else on 127.0.0.1.
+func StartFarm(zone Zone, scripts ...Script) (*Farm, error) {
+	farm := &Farm{}
+	for i, script := range scripts {
+		ip := "127.0.0.1"
+		if runtime.GOOS == "linux" { // whole 127.0.0.0/8 is local
+			ip = fmt.Sprintf("127.0.%d.%d", (i+2)>>8&0xff, (i+2)&0xff)
+		}
+		srv, err := Start(ip, zone, script)
+		if err != nil {
+			farm.Close()
+			return nil, err
+		}
+		farm.Servers = append(farm.Servers, srv)
+	}
+	return farm, nil
+}
+
+// Addrs returns the "ip:port" address of each server.
+func (f *Farm) Addrs() []string {
+	addrs := make([]string, len(f.Servers))
+	for i, srv := range f.Servers {
+		addrs[i] = srv.Addr
+	}
+	return addrs
+}
+
+// Close stops every server.
+func (f *Farm) Close() {
+	for _, srv := range f.Servers {
+		srv.Close()
+	}
+}
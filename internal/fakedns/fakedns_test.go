@@ -0,0 +1,82 @@
+package fakedns
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+var testZone = Zone{
+	"a.test":     {A: []string{"192.0.2.1"}},
+	"cname.test": {CNAME: []string{"a.test"}, A: []string{"192.0.2.1"}},
+}
+
+func TestScripts(t *testing.T) {
+	farm, err := StartFarm(testZone,
+		Script{},
+		Script{Hijack: "203.0.113.66"},
+		Script{NXRedirect: "203.0.113.77"},
+		Script{Drop: true},
+		Script{Delay: 100 * time.Millisecond},
+		Script{RefuseAfter: 1},
+		Script{Truncate: true},
+	)
+	if err != nil {
+		t.Fatalf("StartFarm: %v", err)
+	}
+	defer farm.Close()
+	addrs := farm.Addrs()
+
+	tests := []struct {
+		name   string
+		server string
+		domain string
+		want   string
+	}{
+		{"correct", addrs[0], "a.test", "a.test A=192.0.2.1"},
+		{"correct_cname", addrs[0], "CNAME.test", "CNAME.test A=192.0.2.1 CNAME=a.test."},
+		{"correct_nx", addrs[0], "nx.test", "nx.test NXDOMAIN"},
+		{"hijack", addrs[1], "a.test", "a.test A=203.0.113.66"},
+		{"nxredirect_existing", addrs[2], "a.test", "a.test A=192.0.2.1"},
+		{"nxredirect", addrs[2], "nx.test", "nx.test A=203.0.113.77"},
+		{"drop", addrs[3], "a.test", "a.test TIMEOUT"},
+		{"delay", addrs[4], "a.test", "a.test A=192.0.2.1"},
+		{"refuse_first", addrs[5], "a.test", "a.test A=192.0.2.1"},
+		{"refuse_after", addrs[5], "a.test", "a.test REFUSED"},
+		{"truncate", addrs[6], "a.test", "a.test NOERROR [TC=1]"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := dns.ResolveDNS(
+				tc.domain, tc.server, 500*time.Millisecond, context.Background())
+			if got.ToString() != tc.want {
+				t.Errorf("got %q, want %q", got.ToString(), tc.want)
+			}
+		})
+	}
+	if n := farm.Servers[3].Queries(); n != 1 {
+		t.Errorf("drop server: got %d queries, want 1", n)
+	}
+}
+
+func TestFarmAddrs(t *testing.T) {
+	farm, err := StartFarm(testZone, Script{}, Script{}, Script{})
+	if err != nil {
+		t.Fatalf("StartFarm: %v", err)
+	}
+	defer farm.Close()
+	addrs := farm.Addrs()
+	seen := map[string]bool{}
+	for _, addr := range addrs {
+		if seen[addr] {
+			t.Errorf("duplicate server address %q in %v", addr, addrs)
+		}
+		seen[addr] = true
+	}
+	if !reflect.DeepEqual(addrs, farm.Addrs()) {
+		t.Errorf("Addrs() is not stable")
+	}
+}
@@ -0,0 +1,126 @@
+package netutil
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// asnRange maps an inclusive address range to an AS number.
+type asnRange struct {
+	first netip.Addr
+	last  netip.Addr
+	asn   uint32
+}
+
+// ASNDB is an in-memory IP to ASN database, loaded from a local file.
+// It is read-only once loaded, hence safe for concurrent use.
+type ASNDB struct {
+	ranges  []asnRange   // sorted by first address (then widest first)
+	maxLast []netip.Addr // maxLast[i]: highest last address in ranges[:i+1]
+}
+
+// LoadASNDB reads an IP to ASN database. Each line is either
+// "<CIDR> <ASN>" or "<first-ip> <last-ip> <ASN> [...]" (iptoasn.com TSV
+// format). ASNs may be prefixed with "AS"; '#' starts a comment.
+func LoadASNDB(path string) (*ASNDB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	defer file.Close()
+
+	db := &ASNDB{}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(strings.Split(scanner.Text(), "#")[0])
+		if line == "" {
+			continue
+		}
+		r, err := parseASNLine(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("%v line %v: %w", path, lineNo, err)
+		}
+		db.ranges = append(db.ranges, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Can't read %q: %w", path, err)
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		a, b := db.ranges[i], db.ranges[j]
+		if a.first != b.first {
+			return a.first.Less(b.first)
+		}
+		return b.last.Less(a.last)
+	})
+	db.maxLast = make([]netip.Addr, len(db.ranges))
+	for i, r := range db.ranges {
+		db.maxLast[i] = r.last
+		if i > 0 && r.last.Less(db.maxLast[i-1]) {
+			db.maxLast[i] = db.maxLast[i-1]
+		}
+	}
+	return db, nil
+}
+
+// parseASNLine converts the fields of one database line to an asnRange.
+func parseASNLine(fields []string) (asnRange, error) {
+	var r asnRange
+	var asnStr string
+	if len(fields) >= 2 && strings.Contains(fields[0], "/") {
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return r, fmt.Errorf("invalid prefix: %q", fields[0])
+		}
+		r.first, r.last = PrefixRange(prefix.Masked())
+		asnStr = fields[1]
+	} else if len(fields) >= 3 {
+		first, err1 := netip.ParseAddr(fields[0])
+		last, err2 := netip.ParseAddr(fields[1])
+		if err1 != nil || err2 != nil || first.Is4() != last.Is4() ||
+			last.Less(first) {
+			return r, fmt.Errorf("invalid range: %q - %q", fields[0], fields[1])
+		}
+		r.first, r.last = first.Unmap(), last.Unmap()
+		asnStr = fields[2]
+	} else {
+		return r, fmt.Errorf("expected '<CIDR> <ASN>' or '<first> <last> <ASN>'")
+	}
+	asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asnStr), "AS"), 10, 32)
+	if err != nil {
+		return r, fmt.Errorf("invalid ASN: %q", asnStr)
+	}
+	r.asn = uint32(asn)
+	return r, nil
+}
+
+// Lookup returns the ASN announcing ip (most specific range wins).
+// ok is false when ip is not covered, or mapped to ASN 0 ("not routed").
+func (db *ASNDB) Lookup(ip netip.Addr) (asn uint32, ok bool) {
+	if db == nil || !ip.IsValid() {
+		return 0, false
+	}
+	ip = ip.Unmap()
+	// index of the last range starting at or before ip
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return ip.Less(db.ranges[i].first)
+	}) - 1
+	// walk back while an earlier range may still cover ip
+	for ; i >= 0 && !db.maxLast[i].Less(ip); i-- {
+		if r := db.ranges[i]; !r.last.Less(ip) {
+			return r.asn, r.asn != 0
+		}
+	}
+	return 0, false
+}
+
+// Len returns the number of ranges in the database.
+func (db *ASNDB) Len() int {
+	return len(db.ranges)
+}
@@ -0,0 +1,83 @@
+package netutil
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDB writes content to a temporary database file and returns its path.
+func writeDB(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "asn.db")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write asn db: %v", err)
+	}
+	return path
+}
+
+func TestLoadASNDB_Lookup(t *testing.T) {
+	path := writeDB(t, `
+	# CIDR format, nested prefixes
+	10.0.0.0/8       AS100
+	10.1.0.0/16      200
+	2001:db8::/32    300
+	# iptoasn TSV format
+	192.0.2.0	192.0.2.127	400	US	EXAMPLE-NET
+	198.51.100.0	198.51.100.255	0	None	Not routed
+	`)
+	db, err := LoadASNDB(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.Len() != 5 {
+		t.Fatalf("expected 5 ranges, got %d", db.Len())
+	}
+	cases := []struct {
+		ip   string
+		asn  uint32
+		isOK bool
+	}{
+		{"10.1.2.3", 200, true}, // most specific wins
+		{"10.2.0.1", 100, true}, // falls back to wider prefix
+		{"10.255.255.255", 100, true},
+		{"192.0.2.127", 400, true},
+		{"192.0.2.128", 0, false},
+		{"198.51.100.7", 0, false}, // ASN 0 == not routed
+		{"2001:db8::53", 300, true},
+		{"::ffff:10.1.0.1", 200, true}, // v4-mapped address
+		{"2001:db9::1", 0, false},
+		{"9.9.9.9", 0, false},
+	}
+	for _, c := range cases {
+		asn, ok := db.Lookup(netip.MustParseAddr(c.ip))
+		if asn != c.asn || ok != c.isOK {
+			t.Errorf("Lookup(%s) = (%d, %v), want (%d, %v)", c.ip, asn, ok, c.asn, c.isOK)
+		}
+	}
+	var nilDB *ASNDB
+	if _, ok := nilDB.Lookup(netip.MustParseAddr("10.0.0.1")); ok {
+		t.Error("nil database must not resolve anything")
+	}
+}
+
+func TestLoadASNDB_Errors(t *testing.T) {
+	if _, err := LoadASNDB(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+	bad := []string{
+		"10.0.0.0/33 100",
+		"10.0.0.0/8 ASX",
+		"10.0.0.9 10.0.0.1 100",
+		"10.0.0.1 ::1 100",
+		"10.0.0.1",
+	}
+	for _, content := range bad {
+		_, err := LoadASNDB(writeDB(t, "# header\n"+content+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("expected line 2 error for %q, got %v", content, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package netutil
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+)
+
+// IPRange is an inclusive range of addresses of the same family.
+type IPRange struct {
+	First netip.Addr
+	Last  netip.Addr
+	Bits  int // prefix length if parsed from a CIDR, else -1
+}
+
+// ParseIPRange parses a single IP, a CIDR ("192.0.2.0/24") or an
+// inclusive range ("192.0.2.10-192.0.2.50"). Zones are not allowed.
+func ParseIPRange(s string) (IPRange, error) {
+	var r IPRange
+	switch {
+	case strings.Contains(s, "/"):
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil || prefix.Addr().Zone() != "" {
+			return r, fmt.Errorf("Invalid CIDR: %q", s)
+		}
+		prefix = prefix.Masked()
+		r.First, r.Last = PrefixRange(prefix)
+		r.Bits = prefix.Bits()
+	case strings.Contains(s, "-"):
+		firstStr, lastStr, _ := strings.Cut(s, "-")
+		first, err1 := netip.ParseAddr(strings.TrimSpace(firstStr))
+		last, err2 := netip.ParseAddr(strings.TrimSpace(lastStr))
+		if err1 != nil || err2 != nil || first.Zone() != "" || last.Zone() != "" ||
+			first.Is4() != last.Is4() || last.Less(first) {
+			return r, fmt.Errorf("Invalid IP range: %q", s)
+		}
+		r.First, r.Last, r.Bits = first, last, -1
+	default:
+		ip, err := netip.ParseAddr(s)
+		if err != nil || ip.Zone() != "" {
+			return r, fmt.Errorf("Invalid IP: %q", s)
+		}
+		r.First, r.Last, r.Bits = ip, ip, -1
+	}
+	return r, nil
+}
+
+// Size returns the number of addresses in the range (saturated at
+// math.MaxUint64 for huge IPv6 ranges).
+func (r IPRange) Size() uint64 {
+	a, b := r.First.As16(), r.Last.As16()
+	var hiA, loA, hiB, loB uint64
+	for i := 0; i < 8; i++ {
+		hiA, hiB = hiA<<8|uint64(a[i]), hiB<<8|uint64(b[i])
+		loA, loB = loA<<8|uint64(a[i+8]), loB<<8|uint64(b[i+8])
+	}
+	hi, lo := hiB-hiA, loB-loA
+	if loB < loA {
+		hi-- // borrow
+	}
+	if hi > 0 || lo == math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return lo + 1
+}
+
+// WithoutNetBcast excludes the network and broadcast addresses of IPv4
+// CIDRs (from /0 to /30). Other ranges are returned as-is.
+func (r IPRange) WithoutNetBcast() IPRange {
+	if r.First.Is4() && r.Bits >= 0 && r.Bits <= 30 {
+		r.First, r.Last = r.First.Next(), r.Last.Prev()
+	}
+	return r
+}
@@ -0,0 +1,62 @@
+package netutil
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	cases := []struct {
+		in          string
+		first, last string
+		size        uint64
+	}{
+		{"192.0.2.1", "192.0.2.1", "192.0.2.1", 1},
+		{"192.0.2.77/24", "192.0.2.0", "192.0.2.255", 256},
+		{"198.51.100.10-198.51.100.50", "198.51.100.10", "198.51.100.50", 41},
+		{"198.51.100.10 - 198.51.100.10", "198.51.100.10", "198.51.100.10", 1},
+		{"2001:db8::/120", "2001:db8::", "2001:db8::ff", 256},
+		{"2001:db8::fffe-2001:db8::1:1", "2001:db8::fffe", "2001:db8::1:1", 4},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255", 1 << 32},
+		{"2001:db8::/64", "2001:db8::", "2001:db8::ffff:ffff:ffff:ffff", math.MaxUint64},
+		{"::/0", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", math.MaxUint64},
+	}
+	for _, c := range cases {
+		r, err := ParseIPRange(c.in)
+		if err != nil {
+			t.Errorf("ParseIPRange(%q): %v", c.in, err)
+			continue
+		}
+		if r.First.String() != c.first || r.Last.String() != c.last || r.Size() != c.size {
+			t.Errorf("ParseIPRange(%q) = %s-%s (%d), want %s-%s (%d)",
+				c.in, r.First, r.Last, r.Size(), c.first, c.last, c.size)
+		}
+	}
+	for _, bad := range []string{
+		"", "999.1.1.1", "192.0.2.0/33", "192.0.2.9-192.0.2.1",
+		"192.0.2.1-2001:db8::1", "fe80::1%eth0", "a-b", "192.0.2.1-",
+	} {
+		if _, err := ParseIPRange(bad); err == nil {
+			t.Errorf("ParseIPRange(%q): expected error", bad)
+		}
+	}
+}
+
+func TestIPRangeWithoutNetBcast(t *testing.T) {
+	cases := map[string][2]string{
+		"192.0.2.0/24":          {"192.0.2.1", "192.0.2.254"},
+		"192.0.2.0/30":          {"192.0.2.1", "192.0.2.2"},
+		"192.0.2.0/31":          {"192.0.2.0", "192.0.2.1"}, // point-to-point
+		"192.0.2.10-192.0.2.20": {"192.0.2.10", "192.0.2.20"},
+		"2001:db8::/126":        {"2001:db8::", "2001:db8::3"},
+		"192.0.2.1":             {"192.0.2.1", "192.0.2.1"},
+	}
+	for in, want := range cases {
+		r, _ := ParseIPRange(in)
+		r = r.WithoutNetBcast()
+		if r.First.String() != want[0] || r.Last.String() != want[1] {
+			t.Errorf("%s without net/bcast = %s-%s, want %s-%s",
+				in, r.First, r.Last, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package netutil
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// IPSet is an immutable set of addresses, stored as sorted, disjoint
+// ranges for O(log n) lookups.
+type IPSet struct {
+	ranges []IPRange
+}
+
+// NewIPSet returns the union of ranges (which may overlap).
+func NewIPSet(ranges []IPRange) *IPSet {
+	sorted := append([]IPRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].First.Less(sorted[j].First)
+	})
+	set := &IPSet{}
+	for _, r := range sorted {
+		r.Bits = -1
+		n := len(set.ranges)
+		if n > 0 {
+			last := &set.ranges[n-1]
+			// merge overlapping or adjacent ranges of the same family
+			if last.First.Is4() == r.First.Is4() &&
+				(!last.Last.Less(r.First) || last.Last.Next() == r.First) {
+				if last.Last.Less(r.Last) {
+					last.Last = r.Last
+				}
+				continue
+			}
+		}
+		set.ranges = append(set.ranges, r)
+	}
+	return set
+}
+
+// Contains returns true if ip is in the set.
+// IPv4-mapped IPv6 addresses are looked up as IPv4.
+func (s *IPSet) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	// first range starting after ip: the previous one may contain it
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return ip.Less(s.ranges[i].First)
+	})
+	return i > 0 && !s.ranges[i-1].Last.Less(ip)
+}
+
+// Len returns the number of disjoint ranges in the set.
+func (s *IPSet) Len() int {
+	return len(s.ranges)
+}
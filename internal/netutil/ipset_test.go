@@ -0,0 +1,48 @@
+package netutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPSet(t *testing.T) {
+	var ranges []IPRange
+	for _, s := range []string{
+		"10.0.0.0/24", "10.0.0.128-10.0.1.10", // overlapping
+		"10.0.1.11",           // adjacent
+		"192.0.2.7",           // single IP
+		"2001:db8::/64", "::", // IPv6
+	} {
+		r, err := ParseIPRange(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranges = append(ranges, r)
+	}
+	set := NewIPSet(ranges)
+	if set.Len() != 4 {
+		t.Fatalf("expected 4 merged ranges, got %d", set.Len())
+	}
+	for ip, want := range map[string]bool{
+		"9.255.255.255":   false,
+		"10.0.0.0":        true,
+		"10.0.0.200":      true,
+		"10.0.1.11":       true,
+		"10.0.1.12":       false,
+		"192.0.2.7":       true,
+		"192.0.2.8":       false,
+		"::ffff:10.0.0.1": true,
+		"::":              true,
+		"::1":             false,
+		"2001:db8::dead":  true,
+		"2001:db8:0:1::":  false,
+		"255.255.255.255": false,
+	} {
+		if got := set.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if NewIPSet(nil).Contains(netip.MustParseAddr("1.1.1.1")) {
+		t.Error("empty set must contain nothing")
+	}
+}
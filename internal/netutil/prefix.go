@@ -0,0 +1,39 @@
+package netutil
+
+import (
+	"net/netip"
+)
+
+// PrefixRange returns the first and last addresses of a masked prefix.
+func PrefixRange(prefix netip.Prefix) (first, last netip.Addr) {
+	first = prefix.Addr()
+	bytes := first.AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 1 << (7 - bit%8)
+	}
+	last, _ = netip.AddrFromSlice(bytes)
+	return first, last
+}
+
+// NetworkOf returns the network of ip, using bits4 (IPv4) or bits6
+// (IPv6) as prefix length.
+func NetworkOf(ip netip.Addr, bits4, bits6 int) (netip.Prefix, bool) {
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return netip.Prefix{}, false
+	}
+	bits := bits6
+	if ip.Is4() {
+		bits = bits4
+	}
+	prefix, err := ip.Prefix(bits)
+	return prefix, err == nil
+}
+
+// SamePrefix returns true if a and b belong to the same network, using
+// bits4 (IPv4) or bits6 (IPv6) as prefix length.
+func SamePrefix(a, b netip.Addr, bits4, bits6 int) bool {
+	pa, ok1 := NetworkOf(a, bits4, bits6)
+	pb, ok2 := NetworkOf(b, bits4, bits6)
+	return ok1 && ok2 && pa == pb
+}
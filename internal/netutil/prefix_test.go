@@ -0,0 +1,62 @@
+package netutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPrefixRange(t *testing.T) {
+	cases := map[string][2]string{
+		"192.0.2.0/24":  {"192.0.2.0", "192.0.2.255"},
+		"10.0.0.0/8":    {"10.0.0.0", "10.255.255.255"},
+		"1.2.3.4/32":    {"1.2.3.4", "1.2.3.4"},
+		"2001:db8::/32": {"2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+	}
+	for prefix, want := range cases {
+		first, last := PrefixRange(netip.MustParsePrefix(prefix))
+		if first.String() != want[0] || last.String() != want[1] {
+			t.Errorf("PrefixRange(%s) = %s-%s, want %s-%s",
+				prefix, first, last, want[0], want[1])
+		}
+	}
+}
+
+func TestSamePrefix(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"192.0.2.1", "192.0.2.254", true},
+		{"192.0.2.1", "192.0.3.1", false},
+		{"::ffff:192.0.2.1", "192.0.2.9", true},
+		{"2001:db8:1::1", "2001:db8:1:ffff::1", true},
+		{"2001:db8:1::1", "2001:db8:2::1", false},
+		{"192.0.2.1", "2001:db8::1", false},
+	}
+	for _, c := range cases {
+		got := SamePrefix(netip.MustParseAddr(c.a), netip.MustParseAddr(c.b), 24, 48)
+		if got != c.want {
+			t.Errorf("SamePrefix(%s, %s) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+	if SamePrefix(netip.Addr{}, netip.MustParseAddr("1.1.1.1"), 24, 48) {
+		t.Error("invalid address must never match")
+	}
+}
+
+func TestNetworkOf(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.77":       "192.0.2.0/24",
+		"::ffff:192.0.2.1": "192.0.2.0/24",
+		"2001:db8:1:2::1":  "2001:db8:1::/48",
+	}
+	for ip, want := range cases {
+		got, ok := NetworkOf(netip.MustParseAddr(ip), 24, 48)
+		if !ok || got.String() != want {
+			t.Errorf("NetworkOf(%s) = %v (%v), want %s", ip, got, ok, want)
+		}
+	}
+	if _, ok := NetworkOf(netip.Addr{}, 24, 48); ok {
+		t.Error("invalid address must not have a network")
+	}
+}
@@ -0,0 +1,32 @@
+package netutil
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseServerAddr parses a DNS server address: an IP, or an IP and a
+// port ("192.0.2.1:5353", "[2001:db8::1]:5353"). Port is 0 if unset.
+// Zones are not allowed.
+func ParseServerAddr(s string) (netip.AddrPort, error) {
+	if ip, err := netip.ParseAddr(s); err == nil && ip.Zone() == "" {
+		return netip.AddrPortFrom(ip, 0), nil
+	}
+	if strings.Contains(s, ":") {
+		addr, err := netip.ParseAddrPort(s)
+		if err == nil && addr.Addr().Zone() == "" && addr.Port() != 0 {
+			return addr, nil
+		}
+	}
+	return netip.AddrPort{}, fmt.Errorf("Invalid IP: %q", s)
+}
+
+// FormatServerAddr is the reverse of ParseServerAddr(): the port is only
+// shown if set.
+func FormatServerAddr(addr netip.AddrPort) string {
+	if addr.Port() == 0 {
+		return addr.Addr().String()
+	}
+	return addr.String()
+}
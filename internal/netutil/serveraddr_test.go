@@ -0,0 +1,35 @@
+package netutil
+
+import (
+	"testing"
+)
+
+func TestParseServerAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"192.0.2.1":           "192.0.2.1",
+		"192.0.2.1:5353":      "192.0.2.1:5353",
+		"2001:db8::1":         "2001:db8::1",
+		"[2001:db8::1]:5353":  "[2001:db8::1]:5353",
+		"[2001:db8::1]:53":    "[2001:db8::1]:53",
+		"::ffff:192.0.2.1":    "::ffff:192.0.2.1",
+		"127.0.0.1:65535":     "127.0.0.1:65535",
+		"[::ffff:1.2.3.4]:53": "[::ffff:1.2.3.4]:53",
+	} {
+		addr, err := ParseServerAddr(in)
+		if err != nil {
+			t.Errorf("ParseServerAddr(%q): %v", in, err)
+			continue
+		}
+		if got := FormatServerAddr(addr); got != want {
+			t.Errorf("FormatServerAddr(ParseServerAddr(%q)) = %q, want %q", in, got, want)
+		}
+	}
+	for _, bad := range []string{
+		"", "nope", "192.0.2.1:", "192.0.2.1:0", "192.0.2.1:65536",
+		"2001:db8::1:5353x", "fe80::1%eth0", "[fe80::1%eth0]:53", "192.0.2.0/24",
+	} {
+		if _, err := ParseServerAddr(bad); err == nil {
+			t.Errorf("ParseServerAddr(%q): expected error", bad)
+		}
+	}
+}
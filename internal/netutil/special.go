@@ -0,0 +1,58 @@
+package netutil
+
+import (
+	"net/netip"
+)
+
+// specialPurpose lists address blocks which can't host a public DNS
+// server (IANA IPv4/IPv6 Special-Purpose Address Registries, and bogons).
+var specialPurpose = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	// IPv4
+	{netip.MustParsePrefix("0.0.0.0/8"), "reserved"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "private"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "shared"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link-local"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "private"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "reserved"},
+	{netip.MustParsePrefix("192.0.2.0/24"), "documentation"},
+	{netip.MustParsePrefix("192.88.99.0/24"), "reserved"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "private"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking"},
+	{netip.MustParsePrefix("198.51.100.0/24"), "documentation"},
+	{netip.MustParsePrefix("203.0.113.0/24"), "documentation"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "multicast"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved"},
+	// IPv6
+	{netip.MustParsePrefix("::1/128"), "loopback"},
+	{netip.MustParsePrefix("2001:2::/48"), "benchmarking"},
+	{netip.MustParsePrefix("2001:10::/28"), "reserved"},
+	{netip.MustParsePrefix("2001:20::/28"), "reserved"},
+	{netip.MustParsePrefix("2001:db8::/32"), "documentation"},
+	{netip.MustParsePrefix("3fff::/20"), "documentation"},
+	{netip.MustParsePrefix("fc00::/7"), "private"},
+	{netip.MustParsePrefix("fe80::/10"), "link-local"},
+	{netip.MustParsePrefix("ff00::/8"), "multicast"},
+}
+
+// globalUnicast6 is the only IPv6 block allocated for public unicast.
+var globalUnicast6 = netip.MustParsePrefix("2000::/3")
+
+// SpecialPurpose tells whether ip belongs to a special-purpose block
+// (private, loopback, multicast, documentation...), and which one.
+// IPv4-mapped IPv6 addresses are checked as IPv4.
+func SpecialPurpose(ip netip.Addr) (reason string, ok bool) {
+	ip = ip.Unmap()
+	for _, sp := range specialPurpose {
+		if sp.prefix.Contains(ip) {
+			return sp.reason, true
+		}
+	}
+	if ip.Is6() && !globalUnicast6.Contains(ip) {
+		return "reserved", true
+	}
+	return "", false
+}
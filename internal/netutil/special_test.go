@@ -0,0 +1,40 @@
+package netutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSpecialPurpose(t *testing.T) {
+	cases := map[string]string{
+		"8.8.8.8":                  "",
+		"1.1.1.1":                  "",
+		"2001:4860:4860::8888":     "",
+		"0.1.2.3":                  "reserved",
+		"10.20.30.40":              "private",
+		"172.31.255.255":           "private",
+		"172.32.0.1":               "",
+		"100.64.0.1":               "shared",
+		"127.0.0.53":               "loopback",
+		"169.254.169.254":          "link-local",
+		"192.0.2.1":                "documentation",
+		"198.19.0.1":               "benchmarking",
+		"224.0.0.251":              "multicast",
+		"255.255.255.255":          "reserved",
+		"::1":                      "loopback",
+		"::":                       "reserved",
+		"::ffff:192.168.1.1":       "private",
+		"64:ff9b::808:808":         "reserved",
+		"2001:db8::53":             "documentation",
+		"fd00::1":                  "private",
+		"fe80::1":                  "link-local",
+		"ff02::fb":                 "multicast",
+		"2a00:1450:4001:81b::200e": "",
+	}
+	for ip, want := range cases {
+		reason, ok := SpecialPurpose(netip.MustParseAddr(ip))
+		if reason != want || ok != (want != "") {
+			t.Errorf("SpecialPurpose(%s) = %q,%v, want %q", ip, reason, ok, want)
+		}
+	}
+}
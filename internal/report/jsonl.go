@@ -0,0 +1,71 @@
+package report
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// ServerResult is the JSON Lines (-oJ) record of a finished server.
+type ServerResult struct {
+	Server    string        `json:"server"`
+	Valid     bool          `json:"valid"`
+	Failed    int           `json:"failed"`              // failed checks
+	Score     float64       `json:"score"`               // reliability, from 0 to 100
+	RateLimit float64       `json:"ratelimit,omitempty"` // learned req/s (-adaptive-ratelimit)
+	Time      time.Time     `json:"time"`                // when the server finished
+	Checks    []CheckResult `json:"checks"`              // in template order
+}
+
+// CheckResult is the last answer of a server to a template entry.
+type CheckResult struct {
+	Domain    string   `json:"domain"`
+	Expected  string   `json:"expected,omitempty"` // template entry
+	Passed    bool     `json:"passed"`
+	Status    string   `json:"status"` // SKIPPED if never run
+	A         []string `json:"a,omitempty"`
+	CNAME     []string `json:"cname,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Attempts  int      `json:"attempts"`   // queries sent
+	ElapsedMs float64  `json:"elapsed_ms"` // time spent in queries (all attempts)
+}
+
+// NewServerResult builds the record of srv, checked against tpl (nil
+// to omit expected answers).
+func NewServerResult(srv *dns.ServerContext, tpl dns.Template) ServerResult {
+	res := ServerResult{
+		Server: srv.IPAddress,
+		Valid:  !srv.Disabled,
+		Failed: srv.FailedCount,
+		Score:  srv.Score(),
+		Time:   time.Now().UTC(),
+		Checks: make([]CheckResult, len(srv.Checks)),
+	}
+	if srv.AdaptiveRate {
+		res.RateLimit = srv.RateLimit
+	}
+	for i, chk := range srv.Checks {
+		res.Checks[i] = CheckResult{
+			Domain:    chk.Answer.Domain,
+			Passed:    chk.Passed,
+			Status:    chk.Answer.Status,
+			A:         chk.Answer.A,
+			CNAME:     chk.Answer.CNAME,
+			Truncated: chk.Answer.Truncated,
+			Attempts:  chk.MaxAttempts - chk.AttemptsLeft,
+			ElapsedMs: math.Round(chk.Elapsed.Seconds()*1e6) / 1e3,
+		}
+		if i < len(tpl) {
+			res.Checks[i].Expected = tpl[i].ToString()
+		}
+	}
+	return res
+}
+
+// JSONLine returns the record of srv as a JSON Lines entry.
+func JSONLine(srv *dns.ServerContext, tpl dns.Template) string {
+	data, _ := json.Marshal(NewServerResult(srv, tpl)) // can't fail
+	return string(data) + "\n"
+}
@@ -0,0 +1,66 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+func TestJSONLine(t *testing.T) {
+	tpl, _ := dns.NewTemplate("a.com A=1.2.3.4\nb.com NXDOMAIN\nc.com NXDOMAIN")
+	srv := dns.NewServerContext("8.8.8.8", tpl, 2)
+	srv.Checks[0] = dns.CheckContext{
+		Answer: &dns.DNSAnswer{Domain: "a.com", DNSAnswerData: dns.DNSAnswerData{
+			Status: "NOERROR", A: []string{"1.2.3.4"}}},
+		Passed: true, AttemptsLeft: 1, MaxAttempts: 2,
+		Elapsed: 12345 * time.Microsecond,
+	}
+	srv.Checks[1] = dns.CheckContext{
+		Answer: &dns.DNSAnswer{Domain: "b.com", DNSAnswerData: dns.DNSAnswerData{
+			Status: "TIMEOUT"}},
+		AttemptsLeft: 0, MaxAttempts: 2, Elapsed: 2 * time.Second,
+	}
+	srv.FailedCount, srv.Disabled = 1, true
+
+	line := JSONLine(srv, tpl)
+	if !strings.HasSuffix(line, "}\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected a single JSON line, got %q", line)
+	}
+	var got ServerResult
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	if got.Server != "8.8.8.8" || got.Valid || got.Failed != 1 || got.Time.IsZero() ||
+		got.Score != srv.Score() || got.Score <= 0 {
+		t.Fatalf("unexpected server fields: %+v", got)
+	}
+	want := []CheckResult{
+		{Domain: "a.com", Expected: "a.com A=1.2.3.4", Passed: true,
+			Status: "NOERROR", A: []string{"1.2.3.4"}, Attempts: 1, ElapsedMs: 12.345},
+		{Domain: "b.com", Expected: "b.com NXDOMAIN",
+			Status: "TIMEOUT", Attempts: 2, ElapsedMs: 2000},
+		{Domain: "c.com", Expected: "c.com NXDOMAIN", Status: "SKIPPED"},
+	}
+	if !reflect.DeepEqual(got.Checks, want) {
+		t.Fatalf("got checks %+v\nwant %+v", got.Checks, want)
+	}
+}
+
+func TestReportFinishedServerJSON(t *testing.T) {
+	t.Parallel()
+	jsonBuf := &bytes.Buffer{}
+	rep := newReporterNoTTY()
+	rep.io.JSONFile = jsonBuf
+
+	rep.ReportFinishedServer(dns.NewServerContext("10.0.0.1", rep.template, 1))
+	rep.ReportFinishedServer(dns.NewServerContext("10.0.0.2", rep.template, 1))
+	lines := strings.Split(strings.TrimSpace(jsonBuf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"server":"10.0.0.2"`) {
+		t.Fatalf("expected one JSON line per server, got:\n%s", jsonBuf.String())
+	}
+}
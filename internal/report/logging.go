@@ -11,10 +11,15 @@ import (
 /* ------------------------------------------------------------------ */
 
 type IOFiles struct {
-	TTYFile     *os.File
-	OutputFile  io.Writer
-	VerboseFile io.Writer
-	DebugFile   io.Writer
+	TTYFile      *os.File
+	OutputFile   io.Writer
+	VerboseFile  io.Writer
+	DebugFile    io.Writer
+	StateFile    *StateWriter // optional -state file
+	JSONFile     io.Writer    // optional -oJ file (JSON Lines)
+	InvalidFile  io.Writer    // optional -o-invalid file
+	TimeoutFile  io.Writer    // optional -o-timeout file
+	UntestedFile io.Writer    // optional -o-untested file
 }
 
 /* ------------------------------------------------------------------ */
@@ -0,0 +1,36 @@
+package report
+
+import (
+	"io"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// StateWriter appends the verdict of finished servers to a -state file.
+// Verdicts are written unbuffered, right after the -o line of the server,
+// so that a crashed run loses none of the servers found in -o file
+// (-resume also skips them, if the crash occurred between both writes).
+type StateWriter struct {
+	w   io.Writer
+	err error // first write error
+}
+
+// NewStateWriter returns a StateWriter appending verdicts to w.
+func NewStateWriter(w io.Writer) *StateWriter {
+	return &StateWriter{w: w}
+}
+
+// Record writes the verdict of a finished server.
+func (sw *StateWriter) Record(srv *dns.ServerContext) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = io.WriteString(sw.w,
+		config.StateLine(srv.IPAddress, !srv.Disabled, srv.FailedCount))
+}
+
+// Err returns the first error met while writing verdicts.
+func (sw *StateWriter) Err() error {
+	return sw.err
+}
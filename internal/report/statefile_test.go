@@ -0,0 +1,59 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+func TestStateWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	sw := NewStateWriter(out)
+
+	valid := dns.NewServerContext("1.1.1.1", dns.Template{{Domain: "a.com"}}, 1)
+	invalid := dns.NewServerContext("8.8.8.8", dns.Template{{Domain: "a.com"}}, 1)
+	invalid.Disabled = true
+	invalid.FailedCount = 1
+	// verdicts are written at once (a crash can't lose them)
+	sw.Record(valid)
+	if got := out.String(); got != "1.1.1.1 valid 0\n" {
+		t.Fatalf("after 1st verdict: %q", got)
+	}
+	sw.Record(invalid)
+	if got := out.String(); got != "1.1.1.1 valid 0\n8.8.8.8 invalid 1\n" {
+		t.Fatalf("after 2nd verdict: %q", got)
+	}
+	if err := sw.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+}
+
+func TestStatusReporterResumeAndState(t *testing.T) {
+	st := newReporterNoTTY()
+	defer st.Stop()
+	total, checks := st.TotalServers, st.TotalChecks
+	st.Resume(&config.ResumeState{Servers: map[string]config.StateEntry{
+		"1.1.1.1": {Valid: true},
+		"8.8.8.8": {Valid: false, FailedCount: 1},
+	}}, 3)
+	if st.TotalServers != total+2 || st.ValidServers != 1 ||
+		st.InvalidServers != 1 || st.ServersWithFailures != 1 {
+		t.Fatalf("unexpected counters after Resume: valid=%d invalid=%d failures=%d total=%d",
+			st.ValidServers, st.InvalidServers, st.ServersWithFailures, st.TotalServers)
+	}
+	if st.TotalChecks != checks+6 || st.DoneChecks != 6 {
+		t.Fatalf("unexpected checks after Resume: total=%d done=%d",
+			st.TotalChecks, st.DoneChecks)
+	}
+
+	// finished servers are recorded in the state file
+	out := &bytes.Buffer{}
+	st.io.StateFile = NewStateWriter(out)
+	st.ReportFinishedServer(
+		dns.NewServerContext("9.9.9.9", dns.Template{{Domain: "a.com"}}, 1))
+	if got := out.String(); got != "9.9.9.9 valid 0\n" {
+		t.Fatalf("state file content: %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -47,20 +48,30 @@ type StatusReporter struct {
 	io           *IOFiles
 	quit         chan struct{}
 	redrawTicker *time.Ticker
+	template     dns.Template // for io.JSONFile records
 	// Display:
 	pBarTemplate   string // progress bar fmt string template
 	pBarEraser     string // ANSI sequence to 'erase' current pbar
 	cacheStr       string // cached data to display @ next redraw
 	spinnerFrame   int    // current spinner frame
 	verboseFileHdr string // printed once before 1st debugFile write
+	numChecks      int    // checks per server
+	totalKnown     bool   // false while streamed server list isn't fully read
 	// Servers Status:
 	TotalServers        int
 	ValidServers        int
 	InvalidServers      int
+	UntestedServers     int // not finished when the run was interrupted
 	ServersWithFailures int
 	// Checks Status:
-	TotalChecks int
-	DoneChecks  int
+	TotalChecks  int
+	DoneChecks   int
+	SavedQueries int // estimated queries saved by check ordering
+	// Hooks:
+	OnServerFinished func(srv *dns.ServerContext) // optional, called by ReportFinishedServer
+	// Output order:
+	SortByScore bool           // hold valid servers, written best first by Stop()
+	scored      []scoredServer // held valid servers (SortByScore)
 	// MISC:
 	StartTime time.Time
 	Requests  RequestsLogger // requests tracking
@@ -84,14 +95,21 @@ func NewStatusReporter(
 		}
 		return fmt.Sprintf("dropped if >%d tests fail", srvMaxFail)
 	}
-	srvRatelimitStr := func() string {
-		s := fmt.Sprintf("max %.10f", set.PerSrvRateLimit)
+	fmtRate := func(rate float64) string {
+		s := fmt.Sprintf("%.10f", rate)
 		return strings.TrimRight(strings.TrimRight(s, "0"), ".")
 	}
+	srvRatelimitStr := func() string {
+		if set.PerSrvAdaptiveRate {
+			return fmt.Sprintf("adaptive %s-%s",
+				fmtRate(set.PerSrvMinRateLimit), fmtRate(set.PerSrvMaxRateLimit))
+		}
+		return "max " + fmtRate(set.PerSrvRateLimit)
+	}
 	pBarTemplate := fmt.Sprintf(
 		"\n"+
 			"\033[1;97m* %-30s\033[2;37m%%10s - %%s\n"+
-			"%%c Run: %d servers * %d tests, max %d req/s, %d jobs (%%d busy)\n"+
+			"%%c Run: %%s servers * %d tests, max %d req/s, %d jobs (%%d busy)\n"+
 			"%%c Per server: %s req/s, %s (%%d in pool)\n"+
 			"%%c Per test: %ds timeout, up to %d attempts -> %%d%%%% done (%%d/%%d)\n"+
 			"%%c │\033[32m%%-22s\033[2;37m%%6d req/s\033[31m%%26s\033[2;37m│\n"+
@@ -99,13 +117,14 @@ func NewStatusReporter(
 		// line 0: title
 		title,
 		// line 1: Run: ? servers * ? tests ...
-		len(set.ServerIPs), len(set.Template),
+		len(set.Template),
 		set.GlobRateLimit, set.MaxThreads,
 		// line 2: Per server: ...
 		srvRatelimitStr(), dropMsg(set.PerSrvMaxFailures),
 		// line 3: Per test: ...
 		set.PerQueryTimeout, set.PerCheckMaxAttempts,
 	)
+	numServers, totalKnown := set.NumServers()
 	s := &StatusReporter{
 		io:           ioFiles,
 		quit:         make(chan struct{}),
@@ -114,8 +133,11 @@ func NewStatusReporter(
 		pBarTemplate:   pBarTemplate,
 		verboseFileHdr: set.Template.PrettyDump(),
 
-		TotalServers: len(set.ServerIPs),
-		TotalChecks:  len(set.ServerIPs) * len(set.Template),
+		numChecks:    len(set.Template),
+		template:     set.Template,
+		totalKnown:   totalKnown,
+		TotalServers: numServers,
+		TotalChecks:  numServers * len(set.Template),
 		StartTime:    time.Now(),
 		Requests:     RequestsLogger{StartTime: time.Now()},
 		PoolSize:     MetricGauge{Max: set.MaxPoolSize},
@@ -159,6 +181,44 @@ func (s *StatusReporter) AddDoneChecks(addDoneChecks, addTotalChecks int) {
 	}
 }
 
+// AddSavedQueries adds to the queries saved by check ordering.
+func (s *StatusReporter) AddSavedQueries(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SavedQueries += n
+}
+
+// AddTotalServers adjusts the total of servers to sanitize (as the
+// streamed server list is read). known tells if the total is final.
+func (s *StatusReporter) AddTotalServers(n int, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.TotalServers += n
+	s.TotalChecks += n * s.numChecks
+	s.totalKnown = known
+}
+
+// AddUntestedServers counts servers left unfinished by an interruption.
+func (s *StatusReporter) AddUntestedServers(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.UntestedServers += n
+}
+
+// Resume accounts for servers finished by a previous run (-resume),
+// each having run checksPerServer checks.
+func (s *StatusReporter) Resume(state *config.ResumeState, checksPerServer int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	valid, invalid, withFailures := state.Counts()
+	s.TotalServers += valid + invalid
+	s.ValidServers += valid
+	s.InvalidServers += invalid
+	s.ServersWithFailures += withFailures
+	s.TotalChecks += (valid + invalid) * checksPerServer
+	s.DoneChecks += (valid + invalid) * checksPerServer
+}
+
 // LogRequests records one idle/busy requests batch.
 func (s *StatusReporter) LogRequests(t time.Time, nIdle, nBusy int) {
 	s.mu.Lock()
@@ -166,6 +226,14 @@ func (s *StatusReporter) LogRequests(t time.Time, nIdle, nBusy int) {
 	s.Requests.Log(t, nIdle, nBusy)
 }
 
+// ReportUntestedServer writes a server left unfinished by an
+// interruption (counted by AddUntestedServers).
+func (s *StatusReporter) ReportUntestedServer(srv *dns.ServerContext) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fWrite(s.io.UntestedFile, srv.IPAddress)
+}
+
 // ReportFinishedServer updates stats and writes results for one server.
 func (s *StatusReporter) ReportFinishedServer(srv *dns.ServerContext) {
 	s.mu.Lock()
@@ -174,11 +242,30 @@ func (s *StatusReporter) ReportFinishedServer(srv *dns.ServerContext) {
 	if srv.FailedCount > 0 {
 		s.ServersWithFailures++
 	}
-	if srv.Disabled {
-		s.InvalidServers++
-	} else {
+	switch verdict, first := Classify(srv); verdict {
+	case VerdictValid:
 		s.ValidServers++
-		s.fWrite(s.io.OutputFile, srv.IPAddress)
+		if s.SortByScore {
+			s.scored = append(s.scored, scoredServer{srv.IPAddress, srv.Score()})
+		} else {
+			s.fWrite(s.io.OutputFile, srv.IPAddress)
+		}
+	case VerdictTimeout:
+		s.InvalidServers++
+		if s.io.TimeoutFile != nil {
+			s.fWrite(s.io.TimeoutFile, rejectLine(srv, first))
+		} else {
+			s.fWrite(s.io.InvalidFile, rejectLine(srv, first))
+		}
+	default:
+		s.InvalidServers++
+		s.fWrite(s.io.InvalidFile, rejectLine(srv, first))
+	}
+	if s.io.StateFile != nil {
+		s.io.StateFile.Record(srv)
+	}
+	if s.io.JSONFile != nil {
+		s.fWrite(s.io.JSONFile, JSONLine(srv, s.template))
 	}
 	if s.io.VerboseFile != nil {
 		if s.verboseFileHdr == "" {
@@ -188,6 +275,9 @@ func (s *StatusReporter) ReportFinishedServer(srv *dns.ServerContext) {
 			s.verboseFileHdr = ""
 		}
 	}
+	if s.OnServerFinished != nil {
+		s.OnServerFinished(srv)
+	}
 }
 
 // Debug prints a formatted debug line when -debug is active.
@@ -204,10 +294,20 @@ func (s *StatusReporter) Debug(format string, args ...interface{}) {
 	}
 }
 
-// Stop stops ticker, renders final bar and cleans up.
+// Stop stops ticker, renders final bar and cleans up. With SortByScore,
+// held valid servers are written, best first.
 func (s *StatusReporter) Stop() {
 	close(s.quit)
 	s.redrawTicker.Stop()
+	s.mu.Lock()
+	sort.SliceStable(s.scored, func(i, j int) bool {
+		return s.scored[i].score > s.scored[j].score
+	})
+	for _, srv := range s.scored {
+		s.fWrite(s.io.OutputFile, srv.ip)
+	}
+	s.scored = nil
+	s.mu.Unlock()
 	if s.hasPBar() {
 		s.io.TTYFile.WriteString(
 			s.pBarEraser + s.cacheStr + s.renderPBar() + "\n\n")
@@ -215,6 +315,12 @@ func (s *StatusReporter) Stop() {
 	}
 }
 
+// scoredServer is a valid server held until Stop() (SortByScore).
+type scoredServer struct {
+	ip    string
+	score float64
+}
+
 /* ------------------------------------------------------------------ */
 /* INTERNAL UTILS --------------------------------------------------- */
 /* ------------------------------------------------------------------ */
@@ -400,6 +506,15 @@ func (s *StatusReporter) renderBrailleBar() string {
 		"\033[31m" + string(invalidRunes)
 }
 
+// renderTotalServers returns TotalServers, suffixed with '+' while
+// the streamed server list isn't fully read.
+func (s *StatusReporter) renderTotalServers() string {
+	if s.totalKnown {
+		return fmt.Sprint(s.TotalServers)
+	}
+	return fmt.Sprintf("%d+", s.TotalServers)
+}
+
 // renderPBar builds the multi-line spinner/progress bar
 // (prepends debug bar if enabled).
 func (s *StatusReporter) renderPBar() string {
@@ -414,6 +529,7 @@ func (s *StatusReporter) renderPBar() string {
 		s.renderRemainingTime(),
 		// line 1: Run: N servers ...
 		SPINNER[s.spinnerFrame][0],
+		s.renderTotalServers(),
 		s.BusyJobs.Current,
 		// line 2: Each server: ...
 		SPINNER[s.spinnerFrame][1],
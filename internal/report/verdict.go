@@ -0,0 +1,52 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// Verdict tells why a finished server was kept or rejected.
+type Verdict int
+
+const (
+	VerdictValid   Verdict = iota // passed enough checks
+	VerdictInvalid                // failed with wrong answers
+	VerdictTimeout                // failed with no response only (flaky)
+)
+
+// Classify returns the verdict of a finished server, and the answer of
+// its first failed check in template order (nil if none).
+func Classify(srv *dns.ServerContext) (Verdict, *dns.DNSAnswer) {
+	var first *dns.DNSAnswer
+	noResponseOnly := true // (timeouts, refused connections...)
+	for _, chk := range srv.Checks {
+		if chk.Passed || chk.Answer == nil || chk.Answer.Status == "SKIPPED" {
+			continue
+		}
+		if first == nil {
+			first = chk.Answer
+		}
+		if chk.Answer.IsResponse() {
+			noResponseOnly = false
+		}
+	}
+	switch {
+	case !srv.Disabled:
+		return VerdictValid, first
+	case first != nil && noResponseOnly:
+		return VerdictTimeout, first
+	default:
+		return VerdictInvalid, first
+	}
+}
+
+// rejectLine describes a rejected server with its first failed check,
+// e.g. "8.8.8.8 example.com A=1.2.3.4", or with its score if none failed
+// (-min-score), e.g. "8.8.8.8 (score 42.5)".
+func rejectLine(srv *dns.ServerContext, first *dns.DNSAnswer) string {
+	if first == nil {
+		return fmt.Sprintf("%s (score %.1f)", srv.IPAddress, srv.Score())
+	}
+	return srv.IPAddress + " " + first.ToString()
+}
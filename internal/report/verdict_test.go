@@ -0,0 +1,119 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/dns"
+)
+
+// finishedServer returns a finished server whose checks got statuses
+// ("" for a passed check, SKIPPED for a check never run).
+func finishedServer(ip string, disabled bool, statuses ...string) *dns.ServerContext {
+	tpl := make(dns.Template, len(statuses))
+	for i := range tpl {
+		tpl[i].Domain = string(rune('a'+i)) + ".com"
+	}
+	srv := dns.NewServerContext(ip, tpl, 1)
+	srv.Disabled = disabled
+	for i, status := range statuses {
+		if status == "SKIPPED" {
+			continue
+		}
+		srv.Checks[i].Passed = status == ""
+		srv.Checks[i].AttemptsLeft = 0
+		if status == "" {
+			status = "NXDOMAIN"
+		} else {
+			srv.FailedCount++
+		}
+		srv.Checks[i].Answer = &dns.DNSAnswer{
+			Domain: tpl[i].Domain, DNSAnswerData: dns.DNSAnswerData{Status: status}}
+	}
+	return srv
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name     string
+		srv      *dns.ServerContext
+		verdict  Verdict
+		firstErr string
+	}{
+		{"valid", finishedServer("1.1.1.1", false, "", ""), VerdictValid, ""},
+		{"valid_with_failure", finishedServer("1.1.1.1", false, "", "TIMEOUT"), VerdictValid, "b.com TIMEOUT"},
+		{"wrong_answer", finishedServer("1.1.1.1", true, "", "NOERROR", "SKIPPED"), VerdictInvalid, "b.com NOERROR"},
+		{"timeout_only", finishedServer("1.1.1.1", true, "TIMEOUT", "", "TIMEOUT"), VerdictTimeout, "a.com TIMEOUT"},
+		{"no_response_only", finishedServer("1.1.1.1", true, "ECONNREFUSED", "TIMEOUT"), VerdictTimeout, "a.com ECONNREFUSED"},
+		{"timeout_then_wrong", finishedServer("1.1.1.1", true, "TIMEOUT", "SERVFAIL"), VerdictInvalid, "a.com TIMEOUT"},
+	}
+	for _, tc := range cases {
+		verdict, first := Classify(tc.srv)
+		firstErr := ""
+		if first != nil {
+			firstErr = first.ToString()
+		}
+		if verdict != tc.verdict || firstErr != tc.firstErr {
+			t.Errorf("%s: got %v %q, want %v %q",
+				tc.name, verdict, firstErr, tc.verdict, tc.firstErr)
+		}
+	}
+}
+
+func TestReportFinishedServerRouting(t *testing.T) {
+	t.Parallel()
+	outBuf, invalidBuf, timeoutBuf, untestedBuf :=
+		&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	rep := newReporterNoTTY()
+	rep.io.OutputFile = outBuf
+	rep.io.InvalidFile = invalidBuf
+	rep.io.UntestedFile = untestedBuf
+
+	rep.ReportFinishedServer(finishedServer("10.0.0.1", false, ""))
+	rep.ReportFinishedServer(finishedServer("10.0.0.2", true, "NOERROR"))
+	rep.ReportFinishedServer(finishedServer("10.0.0.3", true, "TIMEOUT"))
+	rep.ReportUntestedServer(finishedServer("10.0.0.4", false, "SKIPPED"))
+	// without -o-timeout, timeout-only failures are invalid servers
+	if got, want := invalidBuf.String(),
+		"10.0.0.2 a.com NOERROR\n10.0.0.3 a.com TIMEOUT\n"; got != want {
+		t.Fatalf("InvalidFile: got %q, want %q", got, want)
+	}
+
+	rep.io.TimeoutFile = timeoutBuf
+	rep.ReportFinishedServer(finishedServer("10.0.0.5", true, "TIMEOUT"))
+	if outBuf.String() != "10.0.0.1\n" ||
+		timeoutBuf.String() != "10.0.0.5 a.com TIMEOUT\n" ||
+		untestedBuf.String() != "10.0.0.4\n" {
+		t.Fatalf("unexpected routing: out=%q timeout=%q untested=%q",
+			outBuf, timeoutBuf, untestedBuf)
+	}
+	if rep.ValidServers != 1 || rep.InvalidServers != 3 {
+		t.Fatalf("unexpected counters: valid=%d invalid=%d",
+			rep.ValidServers, rep.InvalidServers)
+	}
+}
+
+func TestReportFinishedServerSortByScore(t *testing.T) {
+	t.Parallel()
+	outBuf := &bytes.Buffer{}
+	rep := newReporterNoTTY()
+	rep.io.OutputFile = outBuf
+	rep.SortByScore = true
+
+	slow := finishedServer("10.0.0.1", false, "")
+	slow.Checks[0].Elapsed = time.Second
+	retried := finishedServer("10.0.0.2", false, "")
+	retried.Checks[0].MaxAttempts = 2 // passed on 2nd attempt
+	rep.ReportFinishedServer(retried)
+	rep.ReportFinishedServer(slow)
+	rep.ReportFinishedServer(finishedServer("10.0.0.3", false, ""))
+	rep.ReportFinishedServer(finishedServer("10.0.0.4", true, "NOERROR"))
+	if outBuf.Len() != 0 {
+		t.Fatalf("servers must be held until Stop(), got %q", outBuf)
+	}
+	rep.Stop()
+	if got, want := outBuf.String(), "10.0.0.3\n10.0.0.1\n10.0.0.2\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HealthSet tracks servers across -watch cycles: the healthy ones, and
+// a retry backoff for the failing ones, so that dead servers aren't
+// retested on every cycle.
+//
+// Record() may run while the scheduler calls Due() (they don't share
+// state), other methods must be called between cycles.
+type HealthSet struct {
+	MaxBackoff int // max cycles between retries of a failing server
+
+	cycle   int
+	healthy map[string]struct{}   // valid servers of last cycle
+	failing map[string]*failState // invalid servers, by IP
+	results map[string]bool       // verdicts of current cycle
+}
+
+type failState struct {
+	fails      int // consecutive failed cycles
+	retryCycle int // first cycle where the server is due again
+}
+
+// NewHealthSet returns an empty HealthSet, ready for its 1st cycle.
+func NewHealthSet(maxBackoff int) *HealthSet {
+	return &HealthSet{
+		MaxBackoff: maxBackoff,
+		cycle:      1,
+		healthy:    make(map[string]struct{}),
+		failing:    make(map[string]*failState),
+		results:    make(map[string]bool),
+	}
+}
+
+// Cycle returns the number of the current cycle (starting at 1).
+func (h *HealthSet) Cycle() int {
+	return h.cycle
+}
+
+// Due tells whether ip must be tested during the current cycle: failing
+// servers are retried after 2, 4, 8... cycles (up to MaxBackoff).
+func (h *HealthSet) Due(ip string) bool {
+	fs, ok := h.failing[ip]
+	return !ok || fs.retryCycle <= h.cycle
+}
+
+// Record saves the verdict of a server tested during the current cycle.
+func (h *HealthSet) Record(ip string, valid bool) {
+	h.results[ip] = valid
+}
+
+// EndCycle makes the servers found valid during the current cycle the
+// new healthy set, updates failing servers backoff, and returns the
+// servers which were added to & removed from the healthy set.
+func (h *HealthSet) EndCycle() (added, removed []string) {
+	healthy := make(map[string]struct{})
+	for ip, valid := range h.results {
+		if valid {
+			healthy[ip] = struct{}{}
+			delete(h.failing, ip)
+			if _, ok := h.healthy[ip]; !ok {
+				added = append(added, ip)
+			}
+			continue
+		}
+		fs, ok := h.failing[ip]
+		if !ok {
+			fs = &failState{}
+			h.failing[ip] = fs
+		}
+		fs.fails++
+		fs.retryCycle = h.cycle + min(1<<min(fs.fails, 30), h.MaxBackoff)
+	}
+	for ip := range h.healthy {
+		if _, ok := healthy[ip]; !ok {
+			removed = append(removed, ip)
+		}
+	}
+	// failing servers which were due but not tested left the list
+	for ip, fs := range h.failing {
+		if _, tested := h.results[ip]; !tested && fs.retryCycle <= h.cycle {
+			delete(h.failing, ip)
+		}
+	}
+	h.healthy = healthy
+	h.results = make(map[string]bool)
+	h.cycle++
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// Healthy returns the (sorted) servers of the healthy set.
+func (h *HealthSet) Healthy() []string {
+	ips := make([]string, 0, len(h.healthy))
+	for ip := range h.healthy {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// NumFailing returns the number of failing servers waiting for a retry.
+func (h *HealthSet) NumFailing() int {
+	return len(h.failing)
+}
+
+// WriteFileAtomic replaces path with lines (one per line), through a
+// temporary file renamed over it, so that readers never see a partial
+// file.
+func WriteFileAtomic(path string, lines []string) error {
+	tmp, err := os.CreateTemp(
+		filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	data := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// runCycle records verdicts (ip -> valid) for the servers which are due,
+// like a -watch cycle would, and ends the cycle.
+func runCycle(h *HealthSet, verdicts map[string]bool) (tested, added, removed []string) {
+	for ip, valid := range verdicts {
+		if h.Due(ip) {
+			h.Record(ip, valid)
+			tested = append(tested, ip)
+		}
+	}
+	added, removed = h.EndCycle()
+	return tested, added, removed
+}
+
+func TestHealthSet(t *testing.T) {
+	h := NewHealthSet(4)
+
+	// cycle 1: initial set
+	_, added, removed := runCycle(h, map[string]bool{
+		"192.0.2.1": true, "192.0.2.2": true, "192.0.2.3": false,
+	})
+	if !reflect.DeepEqual(added, []string{"192.0.2.1", "192.0.2.2"}) || removed != nil {
+		t.Fatalf("cycle 1: added=%v removed=%v", added, removed)
+	}
+	if h.NumFailing() != 1 {
+		t.Fatalf("cycle 1: expected 1 failing server, got %d", h.NumFailing())
+	}
+
+	// cycle 2: .2 goes bad, .3 is in backoff (not retested)
+	tested, added, removed := runCycle(h, map[string]bool{
+		"192.0.2.1": true, "192.0.2.2": false, "192.0.2.3": true,
+	})
+	if len(tested) != 2 || added != nil ||
+		!reflect.DeepEqual(removed, []string{"192.0.2.2"}) {
+		t.Fatalf("cycle 2: tested=%v added=%v removed=%v", tested, added, removed)
+	}
+	if got := h.Healthy(); !reflect.DeepEqual(got, []string{"192.0.2.1"}) {
+		t.Fatalf("cycle 2: healthy=%v", got)
+	}
+
+	// cycle 3: .3 is due again (2 cycles after its failure), and is back
+	_, added, _ = runCycle(h, map[string]bool{"192.0.2.1": true, "192.0.2.3": true})
+	if !reflect.DeepEqual(added, []string{"192.0.2.3"}) {
+		t.Fatalf("cycle 3: added=%v", added)
+	}
+}
+
+func TestHealthSetBackoff(t *testing.T) {
+	h := NewHealthSet(4)
+	var testedAt []int
+	for cycle := 1; cycle <= 16; cycle++ {
+		if tested, _, _ := runCycle(h, map[string]bool{"192.0.2.9": false}); tested != nil {
+			testedAt = append(testedAt, cycle)
+		}
+	}
+	// retried after 2, 4, then MaxBackoff (4) cycles
+	if want := []int{1, 3, 7, 11, 15}; !reflect.DeepEqual(testedAt, want) {
+		t.Fatalf("failing server tested at cycles %v, want %v", testedAt, want)
+	}
+	// once due, a server missing from the list is forgotten
+	for h.NumFailing() > 0 && h.Cycle() < 32 {
+		runCycle(h, nil)
+	}
+	if h.NumFailing() != 0 {
+		t.Fatal("failing server removed from the list was never forgotten")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "healthy.txt")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []string{"192.0.2.1", "192.0.2.2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "192.0.2.1\n192.0.2.2\n" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if err := WriteFileAtomic(path, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("expected empty file, got %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("temporary file left behind: %v", entries)
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, "nope", "x"), nil); err == nil {
+		t.Fatal("expected error for missing directory")
+	}
+}
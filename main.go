@@ -2,19 +2,28 @@ package main
 
 import (
 	// standard
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
 	// external
 	// local
 	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
 	"github.com/nil0x42/dnsanity/internal/dnsanitize"
 	"github.com/nil0x42/dnsanity/internal/report"
 	"github.com/nil0x42/dnsanity/internal/tty"
 )
 
 func validateTemplate(
+	ctx context.Context,
 	conf *config.Config,
 	ttyFile *os.File,
 ) bool {
@@ -39,55 +48,394 @@ func validateTemplate(
 		VerboseFile: buffer, // write to buffer for later
 	}
 	status := report.NewStatusReporter(
-		"[step 1/2] Template validation",
+		stepTitle(conf, 1, "Template validation"),
 		ioFiles, settings,
 	)
-	dnsanitize.DNSanitize(settings, status)
+	var finished []*dns.ServerContext
+	status.OnServerFinished = func(srv *dns.ServerContext) {
+		finished = append(finished, srv)
+	}
+	dnsanitize.DNSanitizeContext(ctx, settings, status)
 	status.Stop()
+	if ctx.Err() != nil {
+		return false // interrupted: votes are partial
+	}
 
-	// Fails if at least 1 trusted server has a mismatch:
-	if status.ServersWithFailures > 0 {
+	// Fails if an entry isn't validated by -trusted-quorum servers
+	// (all of them by default, duplicates excluded):
+	numTrusted, _ := settings.NumServers()
+	quorum := conf.Opts.TrustedQuorum
+	if quorum == 0 {
+		quorum = numTrusted
+	}
+	failed, partial := dns.TrustedVotes(conf.Template, finished, quorum)
+	conf.PrunedEntries = nil
+	kept := len(conf.Template) - len(failed)
+	if len(failed) > 0 && conf.Opts.PruneTemplate &&
+		kept >= conf.Opts.MinTplEntries {
+		conf.Template = pruneTemplate(conf.Template, failed)
+		conf.PrunedEntries = failed
+		tty.SmartFprintf(
+			os.Stderr,
+			"\033[1;31m[-] Pruned %d/%d template entries "+
+				"(not validated by %d/%d trusted servers):\n%s\033[0m",
+			len(failed), len(failed)+kept,
+			quorum, numTrusted, renderVotes(failed),
+		)
+		failed = nil
+	}
+	if len(failed) > 0 {
+		pruneMsg := ""
+		if conf.Opts.PruneTemplate {
+			pruneMsg = fmt.Sprintf(
+				"[-] Can't prune: %d entries would be left "+
+					"(-min-template-entries %d)\n",
+				kept, conf.Opts.MinTplEntries)
+		}
 		errMsg := "Template validation error"
 		tty.SmartFprintf(
 			os.Stderr,
 			"%s\n"+
-				"\033[1;31m[-] %s: (%d/%d trusted servers failed)\n"+
+				"\033[1;31m[-] %s: %d/%d entries not validated "+
+				"by %d/%d trusted servers:\n"+
+				"%s%s"+
 				"[-] Possible reasons:\n"+
 				"    - Unreliable internet connection\n"+
 				"    - Outdated template entries\n"+
 				"    - Trusted servers not so trustworthy\n"+
 				"\033[0m",
 			buffer.String(), errMsg,
-			status.ServersWithFailures, len(settings.ServerIPs),
+			len(failed), len(conf.Template),
+			quorum, numTrusted,
+			renderVotes(failed), pruneMsg,
 		)
 		return false
 	}
+	if len(partial) > 0 {
+		tty.SmartFprintf(
+			os.Stderr,
+			"\033[1;34m[*] Template validated by %d/%d trusted servers, "+
+				"despite failures:\n%s\033[0m",
+			quorum, numTrusted, renderVotes(partial),
+		)
+	}
 	return true
 }
 
+// pruneTemplate returns tpl without the failed entries.
+func pruneTemplate(tpl dns.Template, failed []*dns.EntryVotes) dns.Template {
+	pruned := make(map[*dns.TemplateEntry]bool, len(failed))
+	for _, ev := range failed {
+		pruned[ev.Entry] = true
+	}
+	kept := make(dns.Template, 0, len(tpl)-len(failed))
+	for i := range tpl {
+		if !pruned[&tpl[i]] {
+			kept = append(kept, tpl[i])
+		}
+	}
+	return kept
+}
+
+// renderVotes lists entries with failures on trusted servers.
+func renderVotes(votes []*dns.EntryVotes) string {
+	var s string
+	for _, ev := range votes {
+		s += "    - " + ev.ToString() + "\n"
+	}
+	return s
+}
+
+// learnTrustedAnswers resolves the differential template domains with
+// trusted servers, and stores their answers as the expected ones.
+func learnTrustedAnswers(
+	ctx context.Context,
+	conf *config.Config,
+	ttyFile *os.File,
+) bool {
+	settings := &config.Settings{
+		// global
+		ServerIPs:     conf.TrustedDNSList,
+		Template:      conf.Template,
+		MaxThreads:    conf.Opts.Threads,
+		MaxPoolSize:   conf.Opts.MaxPoolSize,
+		GlobRateLimit: conf.Opts.GlobRateLimit,
+		// per server
+		PerSrvRateLimit:   conf.Opts.TrustedRateLimit,
+		PerSrvMaxFailures: len(conf.Template) + 1, // never drop Trusted Srvs
+		// per check
+		PerCheckMaxAttempts: conf.Opts.TrustedAttempts,
+		// per dns query
+		PerQueryTimeout: conf.Opts.TrustedTimeout,
+	}
+	ioFiles := &report.IOFiles{TTYFile: ttyFile}
+	status := report.NewStatusReporter(
+		stepTitle(conf, 1, "Trusted answers collection"),
+		ioFiles, settings,
+	)
+	// answers are learned once every worker is done (entries are
+	// read concurrently while the scheduler runs)
+	var finished []*dns.ServerContext
+	status.OnServerFinished = func(srv *dns.ServerContext) {
+		finished = append(finished, srv)
+	}
+	dnsanitize.DNSanitizeContext(ctx, settings, status)
+	status.Stop()
+	if ctx.Err() != nil {
+		return false // interrupted: answers are partial
+	}
+
+	for _, srv := range finished {
+		for i := range srv.Checks {
+			conf.Template[i].AddLiveAnswer(srv.Checks[i].Answer)
+		}
+	}
+	var missing []string
+	for _, entry := range conf.Template {
+		if len(entry.ValidAnswers) == 0 {
+			missing = append(missing, entry.Domain)
+		}
+	}
+	if len(missing) > 0 {
+		tty.SmartFprintf(
+			os.Stderr,
+			"\033[1;31m[-] Trusted answers collection error: "+
+				"no usable answer for %d/%d domains:\n"+
+				"    %s\n\033[0m",
+			len(missing), len(conf.Template), strings.Join(missing, ", "),
+		)
+		return false
+	}
+	return true
+}
+
+// checkTemplate validates the template, or learns its answers in
+// differential mode. It returns false if ctx is done before completion.
+func checkTemplate(
+	ctx context.Context,
+	conf *config.Config,
+	ttyFile *os.File,
+) bool {
+	if conf.Differential {
+		return learnTrustedAnswers(ctx, conf, ttyFile)
+	}
+	return validateTemplate(ctx, conf, ttyFile)
+}
+
+var (
+	errInterrupted = errors.New("interrupted")
+	errMaxDuration = errors.New("max duration reached")
+)
+
+// runContext returns the context of the run, cancelled on SIGINT/SIGTERM
+// (errInterrupted) or after -max-duration (errMaxDuration).
+func runContext(conf *config.Config) (context.Context, context.CancelFunc) {
+	ctx, interrupt := context.WithCancelCause(context.Background())
+	cancel := func() { interrupt(nil) }
+	if conf.Opts.MaxDuration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(
+			ctx, conf.Opts.MaxDuration, errMaxDuration)
+		cancel = func() { cancelTimeout(); interrupt(nil) }
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			interrupt(errInterrupted)
+		case <-ctx.Done():
+		}
+		signal.Stop(signals) // a 2nd signal kills the process
+	}()
+	return ctx, cancel
+}
+
+// exitCode returns the process exit code once ctx is done
+// (130 if interrupted by a signal).
+func exitCode(ctx context.Context) int {
+	if errors.Is(context.Cause(ctx), errInterrupted) {
+		return 130
+	}
+	return 0
+}
+
+// stepTitle numbers the steps of the run: 1) template validation,
+// 2) liveness pre-filter (only with -prefilter), 3) servers sanitization.
+func stepTitle(conf *config.Config, step int, title string) string {
+	numSteps := 3
+	if !conf.Opts.Prefilter {
+		numSteps = 2
+		step = min(step, 2)
+	}
+	return fmt.Sprintf("[step %d/%d] %s", step, numSteps, title)
+}
+
+// prefilterServers sends a single probe to each server of
+// conf.UntrustedDNS, and replaces it with the responsive ones (spooled to
+// a temporary file, so that huge lists never sit in memory). Dead servers
+// are counted in conf.DeadServers, written to -o-invalid (or -o-timeout)
+// file, and passed to onDead (optional). If ctx is done, unprobed servers
+// are counted in conf.Unprobed, and written to -o-untested file.
+// On error, conf.UntrustedDNS is closed.
+func prefilterServers(
+	ctx context.Context,
+	conf *config.Config,
+	ttyFile *os.File,
+	onDead func(ip string),
+) error {
+	spool, err := os.CreateTemp("", "dnsanity-alive-*")
+	if err != nil {
+		conf.UntrustedDNS.Close()
+		return err
+	}
+	os.Remove(spool.Name()) // (deleted once closed, by sanitizeServers)
+	alive := bufio.NewWriter(spool)
+	numAlive := 0
+
+	settings := &config.Settings{
+		// global
+		ServerSource:  conf.UntrustedDNS,
+		Template:      dns.NewProbeTemplate("."),
+		MaxThreads:    conf.Opts.Threads,
+		MaxPoolSize:   max(conf.Opts.MaxPoolSize, conf.Opts.Threads),
+		GlobRateLimit: conf.Opts.GlobRateLimit,
+		// per network
+		NetRateLimit: conf.Opts.NetRateLimit,
+		NetPrefix4:   conf.Opts.NetPrefix4,
+		NetPrefix6:   conf.Opts.NetPrefix6,
+		ASNRateLimit: conf.Opts.ASNRateLimit,
+		ASNDB:        conf.ASNDB,
+		// per server
+		PerSrvRateLimit:   conf.Opts.RateLimit,
+		PerSrvMaxFailures: 0,
+		// per check
+		PerCheckMaxAttempts: 1,
+		// per dns query
+		PerQueryTimeout: conf.Opts.PrefilterTimeout,
+	}
+	ioFiles := &report.IOFiles{TTYFile: ttyFile}
+	if conf.InvalidFile != nil { // dead servers
+		ioFiles.InvalidFile = conf.InvalidFile
+	}
+	if conf.TimeoutFile != nil {
+		ioFiles.TimeoutFile = conf.TimeoutFile
+	}
+	if conf.UntestedFile != nil {
+		ioFiles.UntestedFile = conf.UntestedFile
+	}
+	if conf.Opts.Debug {
+		ioFiles.DebugFile = os.Stderr
+	}
+	status := report.NewStatusReporter(
+		stepTitle(conf, 2, "Liveness pre-filter"),
+		ioFiles, settings,
+	)
+	conf.DeadServers = 0
+	status.OnServerFinished = func(srv *dns.ServerContext) {
+		if srv.Disabled {
+			conf.DeadServers++
+			if onDead != nil {
+				onDead(srv.IPAddress)
+			}
+			if conf.Opts.Verbose {
+				tty.SmartFprintf(os.Stderr, "\033[1;31m[-] %s is dead (%s)\033[0m\n",
+					srv.IPAddress, srv.Checks[0].Answer.Status)
+			}
+		} else {
+			fmt.Fprintln(alive, srv.IPAddress)
+			numAlive++
+		}
+	}
+	dnsanitize.DNSanitizeContext(ctx, settings, status)
+	status.Stop()
+	conf.Unprobed = status.UntestedServers
+	if ctx.Err() != nil {
+		writeUntested(conf)
+	}
+	conf.UntrustedDNS.Close()
+	if err := alive.Flush(); err != nil {
+		spool.Close()
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return err
+	}
+	conf.UntrustedDNS = conf.UntrustedDNS.Subset(spool, numAlive)
+	return nil
+}
+
+// writeUntested writes the servers of conf.UntrustedDNS not read yet to
+// -o-untested file (if set), after an interruption.
+func writeUntested(conf *config.Config) {
+	if conf.UntestedFile == nil {
+		return
+	}
+	complete, err := conf.UntrustedDNS.WriteUnread(conf.UntestedFile)
+	if err != nil {
+		tty.SmartFprintf(os.Stderr,
+			"\033[1;31m[-] -o-untested: %v\033[0m\n", err)
+	} else if !complete {
+		tty.SmartFprintf(os.Stderr, "\033[1;34m[*] -o-untested: "+
+			"servers not read yet from -list pipe are not listed\033[0m\n")
+	}
+}
+
+// sanitizeServers runs the last step on conf.UntrustedDNS until it's done or
+// ctx is cancelled. onFinished (optional) is called for each finished
+// server.
 func sanitizeServers(
+	ctx context.Context,
 	conf *config.Config,
 	ttyFile *os.File,
+	onFinished func(srv *dns.ServerContext),
 ) {
 	settings := &config.Settings{
 		// global
-		ServerIPs:     conf.UntrustedDNSList,
+		ServerSource:  conf.UntrustedDNS,
 		Template:      conf.Template,
 		MaxThreads:    conf.Opts.Threads,
 		MaxPoolSize:   conf.Opts.MaxPoolSize,
 		GlobRateLimit: conf.Opts.GlobRateLimit,
+		// per network
+		NetRateLimit: conf.Opts.NetRateLimit,
+		NetPrefix4:   conf.Opts.NetPrefix4,
+		NetPrefix6:   conf.Opts.NetPrefix6,
+		ASNRateLimit: conf.Opts.ASNRateLimit,
+		ASNDB:        conf.ASNDB,
 		// per server
-		PerSrvRateLimit:   conf.Opts.RateLimit,
-		PerSrvMaxFailures: conf.Opts.MaxMismatches,
+		PerSrvRateLimit:    conf.Opts.RateLimit,
+		PerSrvAdaptiveRate: conf.Opts.AdaptiveRate,
+		PerSrvMinRateLimit: conf.Opts.MinRateLimit,
+		PerSrvMaxRateLimit: conf.Opts.MaxRateLimit,
+		PerSrvMaxFailures:  conf.Opts.MaxMismatches,
+		PerSrvCheckOrder:   conf.Opts.CheckOrder == "failures",
+		PerSrvMinScore:     conf.Opts.MinScore,
 		// per check
 		PerCheckMaxAttempts: conf.Opts.Attempts,
+		RetryOn:             conf.RetryOn,
+		RetryBackoff:        conf.Opts.RetryBackoff,
+		FastFail:            conf.FastFail,
 		// per dns query
 		PerQueryTimeout: conf.Opts.Timeout,
 	}
 
-	ioFiles := &report.IOFiles{
-		TTYFile:    ttyFile,
-		OutputFile: conf.OutputFile,
+	ioFiles := &report.IOFiles{TTYFile: ttyFile}
+	if conf.OutputFile != nil {
+		ioFiles.OutputFile = conf.OutputFile
+	}
+	if conf.JSONFile != nil {
+		ioFiles.JSONFile = conf.JSONFile
+	}
+	if conf.InvalidFile != nil {
+		ioFiles.InvalidFile = conf.InvalidFile
+	}
+	if conf.TimeoutFile != nil {
+		ioFiles.TimeoutFile = conf.TimeoutFile
+	}
+	if conf.UntestedFile != nil {
+		ioFiles.UntestedFile = conf.UntestedFile
 	}
 	if conf.Opts.Verbose {
 		ioFiles.VerboseFile = os.Stderr
@@ -95,24 +443,64 @@ func sanitizeServers(
 	if conf.Opts.Debug {
 		ioFiles.DebugFile = os.Stderr
 	}
+	if conf.StateFile != nil {
+		ioFiles.StateFile = report.NewStateWriter(conf.StateFile)
+	}
 
 	status := report.NewStatusReporter(
-		"[step 2/2] Servers sanitization",
+		stepTitle(conf, 3, "Servers sanitization"),
 		ioFiles, settings,
 	)
-	dnsanitize.DNSanitize(settings, status)
+	if conf.ResumeState != nil {
+		status.Resume(conf.ResumeState, len(conf.Template))
+	}
+	status.OnServerFinished = onFinished
+	status.SortByScore = conf.Opts.Sort == "score"
+	dnsanitize.DNSanitizeContext(ctx, settings, status)
+	status.Debug("-list: skipped %d duplicates", conf.UntrustedDNS.Skipped())
+	filtered := renderFiltered(conf.UntrustedDNS.Filtered())
+	status.Debug("-list: %s", filtered)
 	status.Stop()
+	if conf.Opts.Verbose && !conf.Opts.Debug {
+		tty.SmartFprintf(os.Stderr, "\033[1;34m[*] -list: %s\033[0m\n", filtered)
+	}
+	if ctx.Err() != nil {
+		writeUntested(conf) // servers not loaded yet are untested too
+	}
+	conf.UntrustedDNS.Close()
+	if err := conf.UntrustedDNS.Err(); err != nil {
+		tty.SmartFprintf(os.Stderr, "\033[1;31m[-] -list: %v\033[0m\n", err)
+	}
+	if ioFiles.StateFile != nil {
+		if err := ioFiles.StateFile.Err(); err != nil {
+			tty.SmartFprintf(os.Stderr,
+				"\033[1;31m[-] -state: %v\033[0m\n", err)
+		}
+	}
 
 	// display final report line:
+	totalServers := status.TotalServers + conf.DeadServers + conf.Unprobed
+	untested := status.UntestedServers + conf.Unprobed
 	successRate := float64(0.0)
-	if status.TotalServers > 0 {
+	if totalServers > 0 {
 		successRate =
-			float64(status.ValidServers) / float64(status.TotalServers)
+			float64(status.ValidServers) / float64(totalServers)
 	}
 	reportStr := fmt.Sprintf(
 		"[*] Valid servers: %d/%d (%.1f%%)",
-		status.ValidServers, status.TotalServers, successRate*100,
+		status.ValidServers, totalServers, successRate*100,
 	)
+	if conf.Opts.Prefilter {
+		reportStr += fmt.Sprintf(", %d dead (pre-filter)", conf.DeadServers)
+	}
+	if settings.PerSrvCheckOrder {
+		reportStr += fmt.Sprintf(
+			", ~%d queries saved by check ordering", status.SavedQueries)
+	}
+	if untested > 0 {
+		reportStr += fmt.Sprintf(
+			", %d untested (%v)", untested, context.Cause(ctx))
+	}
 	if ttyFile != nil {
 		fmt.Fprintf(ttyFile, "\033[1;34m%s\033[0m\n", reportStr)
 	}
@@ -121,7 +509,42 @@ func sanitizeServers(
 	}
 }
 
+// renderFiltered describes servers filtered out of -list, by reason
+// (most frequent first).
+func renderFiltered(filtered map[string]int) string {
+	reasons := make([]string, 0, len(filtered))
+	total := 0
+	for reason, n := range filtered {
+		reasons = append(reasons, reason)
+		total += n
+	}
+	if total == 0 {
+		return "no server filtered out"
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		a, b := reasons[i], reasons[j]
+		return filtered[a] > filtered[b] ||
+			(filtered[a] == filtered[b] && a < b)
+	})
+	details := make([]string, len(reasons))
+	for i, reason := range reasons {
+		details[i] = fmt.Sprintf("%s: %d", reason, filtered[reason])
+	}
+	return fmt.Sprintf("filtered out %d servers (%s)",
+		total, strings.Join(details, ", "))
+}
+
 func main() {
+	// subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "template":
+			os.Exit(runTemplateCmd(os.Args[2:]))
+		case "merge":
+			os.Exit(runMergeCmd(os.Args[2:]))
+		}
+	}
+
 	conf := config.Init()
 	ttyFile := tty.OpenTTY()
 
@@ -133,12 +556,33 @@ func main() {
 			strings.Trim(config.HEADER, "\n"),
 		)
 	}
-	// validate Template
-	if !validateTemplate(conf, ttyFile) {
+	// stop gracefully on SIGINT/SIGTERM or -max-duration
+	ctx, cancel := runContext(conf)
+	defer cancel()
+	if conf.Opts.Watch > 0 {
+		os.Exit(watchServers(ctx, conf, ttyFile))
+	}
+	// validate Template (or learn it in differential mode)
+	if !checkTemplate(ctx, conf, ttyFile) {
+		if ctx.Err() != nil {
+			os.Exit(exitCode(ctx))
+		}
 		os.Exit(3)
 	}
-
+	// drop dead servers
+	if conf.Opts.Prefilter {
+		if err := prefilterServers(ctx, conf, ttyFile, nil); err != nil {
+			tty.SmartFprintf(os.Stderr, "\033[1;31m[-] -prefilter: %v\033[0m\n", err)
+			os.Exit(1)
+		}
+	}
 	// sanitize servers
-	sanitizeServers(conf, ttyFile)
-	os.Exit(0)
+	sanitizeServers(ctx, conf, ttyFile, nil)
+	code := exitCode(ctx)
+	if code == 0 && conf.UntrustedDNS.Err() != nil {
+		code = 1 // -list read error, or invalid entry (pipe)
+	} else if code == 0 && len(conf.PrunedEntries) > 0 {
+		code = 4 // ran with a pruned template
+	}
+	os.Exit(code)
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	// standard
+	"bufio"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	// external
+	// local
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/netutil"
+	"github.com/nil0x42/dnsanity/internal/tty"
+)
+
+const mergeCmdUsage = "Usage: dnsanity merge [-o FILE] [-state FILE] FILE...\n" +
+	"Each FILE is the -state file or the -o file of a (sharded) run.\n" +
+	"Servers are written sorted by address (-sort score order is lost).\n"
+
+// runMergeCmd implements `dnsanity merge`: it combines the -state (or -o)
+// files of sharded runs (deduplicating servers), writes the valid servers,
+// and prints the summary of the whole run. It returns the process exit
+// code.
+func runMergeCmd(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, mergeCmdUsage)
+		fs.PrintDefaults()
+	}
+	outPath := fs.String("o", "/dev/stdout", "file to write valid servers")
+	statePath := fs.String("state", "", "file to write the merged state")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	merged := &config.ResumeState{Servers: make(map[string]config.StateEntry)}
+	dups, conflicts, outputs := 0, 0, 0
+	for _, path := range fs.Args() {
+		state, isOutput, err := loadMergeInput(path)
+		if err != nil {
+			tty.SmartFprintf(os.Stderr, "\033[1;31m[-] %v\033[0m\n", err)
+			return 1
+		}
+		if isOutput {
+			outputs++
+		}
+		for ip := range state.Servers {
+			if merged.Done(ip) {
+				dups++
+			}
+		}
+		conflicts += merged.Merge(state)
+	}
+
+	ips := sortedServers(merged)
+	if err := writeMerged(*outPath, ips, func(ip string) string {
+		if merged.Servers[ip].Valid {
+			return ip + "\n"
+		}
+		return ""
+	}); err != nil {
+		tty.SmartFprintf(os.Stderr, "\033[1;31m[-] -o: %v\033[0m\n", err)
+		return 1
+	}
+	if *statePath != "" {
+		if err := writeMerged(*statePath, ips, func(ip string) string {
+			entry := merged.Servers[ip]
+			return config.StateLine(ip, entry.Valid, entry.FailedCount)
+		}); err != nil {
+			tty.SmartFprintf(os.Stderr, "\033[1;31m[-] -state: %v\033[0m\n", err)
+			return 1
+		}
+	}
+
+	if dups > 0 {
+		tty.SmartFprintf(os.Stderr,
+			"\033[1;34m[*] Skipped %d duplicate(s), %d with conflicting verdicts (kept invalid)\033[0m\n",
+			dups, conflicts)
+	}
+	valid, invalid, _ := merged.Counts()
+	total := valid + invalid
+	successRate := float64(0.0)
+	if total > 0 {
+		successRate = float64(valid) / float64(total)
+	}
+	if outputs > 0 { // -o files don't list invalid servers
+		tty.SmartFprintf(os.Stderr,
+			"\033[1;34m[*] Valid servers: %d, merged from %d file(s) (%d -o file(s): invalid servers unknown)\033[0m\n",
+			valid, fs.NArg(), outputs)
+		return 0
+	}
+	tty.SmartFprintf(os.Stderr,
+		"\033[1;34m[*] Valid servers: %d/%d (%.1f%%), merged from %d file(s)\033[0m\n",
+		valid, total, successRate*100, fs.NArg())
+	return 0
+}
+
+// loadMergeInput loads a -state file, or a -o file (one server per line,
+// all valid) if its first entry has a single field.
+func loadMergeInput(path string) (state *config.ResumeState, isOutput bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("%q: %w", path, err)
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			isOutput = len(strings.Fields(line)) == 1
+			break
+		}
+	}
+	file.Close()
+	if !isOutput {
+		state, err = config.LoadState(path)
+		return state, false, err
+	}
+	state = &config.ResumeState{Servers: make(map[string]config.StateEntry)}
+	return state, true, state.LoadOutput(path)
+}
+
+// sortedServers returns the servers of state, sorted by address (each
+// parsed once).
+func sortedServers(state *config.ResumeState) []string {
+	type server struct {
+		ip   string
+		addr netip.AddrPort
+		ok   bool // addr parsed
+	}
+	servers := make([]server, 0, len(state.Servers))
+	for ip := range state.Servers {
+		addr, err := netutil.ParseServerAddr(ip)
+		servers = append(servers, server{ip, addr, err == nil})
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		a, b := servers[i], servers[j]
+		if a.ok != b.ok { // unparsable addresses last
+			return a.ok
+		} else if !a.ok {
+			return a.ip < b.ip
+		}
+		return a.addr.Compare(b.addr) < 0
+	})
+	ips := make([]string, len(servers))
+	for i, srv := range servers {
+		ips[i] = srv.ip
+	}
+	return ips
+}
+
+// writeMerged writes line(ip) for each of ips to path (STDOUT if
+// "/dev/stdout" or "-").
+func writeMerged(path string, ips []string, line func(ip string) string) error {
+	file := os.Stdout
+	if path != "" && path != "-" && path != "/dev/stdout" {
+		var err error
+		if file, err = os.Create(path); err != nil {
+			return err
+		}
+	}
+	w := bufio.NewWriter(file)
+	for _, ip := range ips {
+		w.WriteString(line(ip))
+	}
+	err := w.Flush()
+	if file != os.Stdout {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
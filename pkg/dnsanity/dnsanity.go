@@ -0,0 +1,362 @@
+// Package dnsanity validates DNS servers against a template of known
+// answers, with the scheduler of the dnsanity command (global & per
+// server rate limits, retries, early drop of failing servers).
+//
+//	tpl := dnsanity.DefaultTemplate()
+//	servers, err := dnsanity.OpenServers("resolvers.txt", dnsanity.SourceOptions{})
+//	...
+//	results, err := dnsanity.Run(ctx, servers, tpl, dnsanity.DefaultOptions())
+//	...
+//	for res := range results {
+//		if res.Valid {
+//			fmt.Println(res.Server)
+//		}
+//	}
+package dnsanity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/dnsanitize"
+	"github.com/nil0x42/dnsanity/internal/netutil"
+)
+
+// Template is a list of domains with their expected answers.
+type Template struct {
+	entries dns.Template
+}
+
+// Len returns the number of entries of the template.
+func (t Template) Len() int {
+	return len(t.entries)
+}
+
+// ServerSource lazily reads servers (IPs, CIDRs or IP ranges).
+type ServerSource struct {
+	src *config.ServerSource
+}
+
+// Total returns the number of servers of the source. known is false
+// when it can't be told before the whole source is read (in which case,
+// servers read so far).
+func (ss *ServerSource) Total() (total int, known bool) {
+	return ss.src.Total()
+}
+
+// Err returns the read error which ended the source, if any.
+func (ss *ServerSource) Err() error {
+	return ss.src.Err()
+}
+
+// Close closes the underlying file (if any).
+func (ss *ServerSource) Close() error {
+	return ss.src.Close()
+}
+
+// SourceOptions tells how OpenServers reads servers.
+type SourceOptions struct {
+	Skip         func(ip string) bool // servers to ignore (nil: none)
+	MaxRangeSize uint64               // max addresses per CIDR/range (0: no ranges)
+	SkipNetBcast bool                 // skip network/broadcast of IPv4 CIDRs
+	Exclude      []string             // IPs, CIDRs or ranges to filter out
+	AllowSpecial bool                 // keep special-purpose addresses
+	Shard        int                  // only keep the Shard-th (1-based)...
+	NumShards    int                  // ...of NumShards disjoint subsets (0: all)
+}
+
+// internal converts o to the options of the dnsanity command.
+func (o SourceOptions) internal() (config.SourceOptions, error) {
+	opts := config.SourceOptions{
+		Skip:         o.Skip,
+		MaxRangeSize: o.MaxRangeSize,
+		SkipNetBcast: o.SkipNetBcast,
+		AllowSpecial: o.AllowSpecial,
+	}
+	if len(o.Exclude) > 0 {
+		ranges := make([]netutil.IPRange, len(o.Exclude))
+		for i, elem := range o.Exclude {
+			r, err := netutil.ParseIPRange(elem)
+			if err != nil {
+				return opts, fmt.Errorf("Exclude: %w", err)
+			}
+			ranges[i] = r
+		}
+		opts.Exclude = netutil.NewIPSet(ranges)
+	}
+	if o.NumShards > 0 {
+		if o.Shard < 1 || o.Shard > o.NumShards {
+			return opts, errors.New("Shard: must be between 1 and NumShards")
+		}
+		opts.Shard = config.Shard{Index: o.Shard, NumShards: o.NumShards}
+	}
+	return opts, nil
+}
+
+// Resolver sends a DNS query (A record of domain) to server (see
+// Options.Resolver). Implementations must be safe for concurrent use,
+// and return early once ctx is done.
+type Resolver interface {
+	Resolve(
+		ctx context.Context,
+		domain string,
+		server string,
+		timeout time.Duration,
+	) *Answer
+}
+
+// ResolverFunc adapts a function to the Resolver interface.
+type ResolverFunc func(
+	ctx context.Context,
+	domain string,
+	server string,
+	timeout time.Duration,
+) *Answer
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(
+	ctx context.Context,
+	domain string,
+	server string,
+	timeout time.Duration,
+) *Answer {
+	return f(ctx, domain, server, timeout)
+}
+
+// Answer is the answer of a server to a DNS query, as returned by a
+// Resolver.
+type Answer struct {
+	Domain    string
+	Status    string   // NOERROR, NXDOMAIN, TIMEOUT, REFUSED...
+	A         []string // sorted A records
+	CNAME     []string // sorted CNAME records
+	Truncated bool     // TC flag set
+}
+
+// newAnswer converts an answer of the dnsanity command.
+func newAnswer(da *dns.DNSAnswer) *Answer {
+	return &Answer{
+		Domain:    da.Domain,
+		Status:    da.Status,
+		A:         da.A,
+		CNAME:     da.CNAME,
+		Truncated: da.Truncated,
+	}
+}
+
+// internal converts a to an answer of the dnsanity command.
+func (a *Answer) internal() *dns.DNSAnswer {
+	return &dns.DNSAnswer{
+		Domain: a.Domain,
+		DNSAnswerData: dns.DNSAnswerData{
+			Status: a.Status,
+			A:      a.A,
+			CNAME:  a.CNAME,
+		},
+		Truncated: a.Truncated,
+	}
+}
+
+// internalResolver adapts r to the scheduler of the dnsanity command
+// (which passes ctx last).
+func internalResolver(r Resolver) dns.Resolver {
+	return dns.ResolverFunc(func(
+		domain, server string, timeout time.Duration, ctx context.Context,
+	) *dns.DNSAnswer {
+		if ans := r.Resolve(ctx, domain, server, timeout); ans != nil {
+			return ans.internal()
+		}
+		return &dns.DNSAnswer{ // (no answer at all)
+			Domain: domain, DNSAnswerData: dns.DNSAnswerData{Status: "TIMEOUT"}}
+	})
+}
+
+// UDPResolver is the default Resolver (UDP queries on port 53).
+var UDPResolver Resolver = ResolverFunc(func(
+	ctx context.Context, domain, server string, timeout time.Duration,
+) *Answer {
+	return newAnswer(dns.UDPResolver.Resolve(domain, server, timeout, ctx))
+})
+
+// DefaultTemplate returns the template used by the dnsanity command.
+func DefaultTemplate() Template {
+	tpl, err := dns.NewTemplate(config.DEFAULT_TEMPLATE)
+	if err != nil {
+		panic(err) // built-in template is tested
+	}
+	return Template{tpl}
+}
+
+// ParseTemplate parses a template (one "<FQDN> <EXPECTED-RESULT>" per
+// line, see dnsanity's README).
+func ParseTemplate(content string) (Template, error) {
+	tpl, err := dns.NewTemplate(content)
+	return Template{tpl}, err
+}
+
+// LoadTemplate loads and merges template files.
+func LoadTemplate(paths ...string) (Template, error) {
+	tpl, err := dns.NewTemplateFromFiles(paths...)
+	return Template{tpl}, err
+}
+
+// OpenServers opens a server list, given as a file path or as a comma
+// separated string. Servers are read lazily while Run() tests them.
+func OpenServers(input string, opts SourceOptions) (*ServerSource, error) {
+	srcOpts, err := opts.internal()
+	if err != nil {
+		return nil, err
+	}
+	src, err := config.OpenServerSource(input, srcOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerSource{src}, nil
+}
+
+// ServerList returns a ServerSource yielding ips (which aren't filtered).
+func ServerList(ips []string) *ServerSource {
+	return &ServerSource{config.NewServerSourceFromList(ips)}
+}
+
+// Options of a Run(). Start from DefaultOptions().
+type Options struct {
+	Threads       int           // max concurrent DNS queries
+	MaxPoolSize   int           // max servers tested at once
+	GlobRateLimit int           // max DNS queries per second
+	RateLimit     float64       // max queries per second per server (0: unlimited)
+	Timeout       time.Duration // DNS query timeout (rounded up to the second)
+	MaxAttempts   int           // max attempts per check, if worth retrying
+	MaxMismatches int           // max failed checks of a valid server
+	MinScore      float64       // min Score of a valid server (0: off)
+	Resolver      Resolver      // sends the DNS queries (nil: UDPResolver)
+
+	// Progress, if set, is called with the run's progress at most every
+	// ProgressInterval, and once the run ends. It is called from the
+	// scheduler goroutine, and must not block.
+	Progress         func(Progress)
+	ProgressInterval time.Duration
+}
+
+// DefaultOptions returns the default options of the dnsanity command.
+func DefaultOptions() Options {
+	return Options{
+		Threads:          10000,
+		MaxPoolSize:      10000,
+		GlobRateLimit:    500,
+		RateLimit:        2,
+		Timeout:          4 * time.Second,
+		MaxAttempts:      2,
+		MaxMismatches:    0,
+		ProgressInterval: time.Second,
+	}
+}
+
+func (o *Options) validate() error {
+	switch {
+	case o.Threads < 1:
+		return errors.New("Threads: must be >= 1")
+	case o.MaxPoolSize < 1:
+		return errors.New("MaxPoolSize: must be >= 1")
+	case o.GlobRateLimit < 1:
+		return errors.New("GlobRateLimit: must be >= 1")
+	case o.RateLimit < 0:
+		return errors.New("RateLimit: must be >= 0")
+	case o.Timeout <= 0:
+		return errors.New("Timeout: must be > 0")
+	case o.MaxAttempts < 1:
+		return errors.New("MaxAttempts: must be >= 1")
+	case o.MaxMismatches < 0:
+		return errors.New("MaxMismatches: must be >= 0")
+	case o.MinScore < 0 || o.MinScore > 100:
+		return errors.New("MinScore: must be between 0 and 100")
+	case o.ProgressInterval < 0:
+		return errors.New("ProgressInterval: must be >= 0")
+	}
+	return nil
+}
+
+// Progress of a Run().
+type Progress struct {
+	TotalServers    int  // servers to test (read so far if !TotalKnown)
+	TotalKnown      bool // false while a streamed source isn't fully read
+	ValidServers    int
+	InvalidServers  int
+	UntestedServers int // unfinished when ctx was cancelled
+	DoneChecks      int
+	TotalChecks     int
+	Requests        int // DNS queries sent
+}
+
+// Result is the verdict of a tested server.
+type Result struct {
+	Server       string        // server IP
+	Valid        bool          // false if more than MaxMismatches checks failed
+	FailedChecks int           // number of failed checks
+	Score        float64       // reliability, from 0 to 100
+	Checks       []CheckResult // in template order
+}
+
+// CheckResult is the last answer of a server to a template entry.
+type CheckResult struct {
+	Domain string
+	Status string   // NOERROR, NXDOMAIN, TIMEOUT... (SKIPPED if never run)
+	A      []string // sorted A records
+	CNAME  []string // sorted CNAME records
+	Passed bool
+}
+
+// Run tests servers against tpl in the background, and returns a
+// channel yielding the result of each server as soon as it is known.
+// The scheduler waits for results to be read, so the channel must be
+// drained until it's closed: once every server is tested, or soon after
+// ctx is done (unfinished servers are counted as untested by Progress,
+// and results may be dropped). Read errors of servers are then returned
+// by servers.Err().
+func Run(
+	ctx context.Context,
+	servers *ServerSource,
+	tpl Template,
+	opts Options,
+) (<-chan Result, error) {
+	if servers == nil {
+		return nil, errors.New("no server source")
+	}
+	if tpl.Len() == 0 {
+		return nil, errors.New("template is empty")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	settings := &config.Settings{
+		// global
+		ServerSource:  servers.src,
+		Template:      tpl.entries,
+		MaxThreads:    opts.Threads,
+		MaxPoolSize:   opts.MaxPoolSize,
+		GlobRateLimit: opts.GlobRateLimit,
+		// per server
+		PerSrvRateLimit:   opts.RateLimit,
+		PerSrvMaxFailures: opts.MaxMismatches,
+		PerSrvMinScore:    opts.MinScore,
+		// per check
+		PerCheckMaxAttempts: opts.MaxAttempts,
+		// per dns query
+		PerQueryTimeout: int((opts.Timeout + time.Second - 1) / time.Second),
+	}
+	if opts.Resolver != nil {
+		settings.Resolver = internalResolver(opts.Resolver)
+	}
+	results := make(chan Result)
+	rep := newReporter(ctx, settings, results, opts)
+	go func() {
+		defer close(results)
+		dnsanitize.DNSanitizeContext(ctx, settings, rep)
+		rep.sendProgress()
+	}()
+	return results, nil
+}
@@ -0,0 +1,179 @@
+package dnsanity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefaultTemplate(t *testing.T) {
+	if DefaultTemplate().Len() == 0 {
+		t.Fatal("default template is empty")
+	}
+}
+
+func TestRunInvalidArgs(t *testing.T) {
+	ctx := context.Background()
+	tpl := DefaultTemplate()
+	servers := ServerList([]string{"127.0.0.1"})
+	if _, err := Run(ctx, nil, tpl, DefaultOptions()); err == nil {
+		t.Error("expected error without server source")
+	}
+	if _, err := Run(ctx, servers, Template{}, DefaultOptions()); err == nil {
+		t.Error("expected error with empty template")
+	}
+	for name, mutate := range map[string]func(*Options){
+		"Threads":     func(o *Options) { o.Threads = 0 },
+		"RateLimit":   func(o *Options) { o.RateLimit = -1 },
+		"Timeout":     func(o *Options) { o.Timeout = 0 },
+		"MaxAttempts": func(o *Options) { o.MaxAttempts = 0 },
+	} {
+		opts := DefaultOptions()
+		mutate(&opts)
+		if _, err := Run(ctx, servers, tpl, opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestRunLoopback runs against a closed port of the loopback interface,
+// which refuses every query (no network needed).
+func TestRunLoopback(t *testing.T) {
+	tpl, err := ParseTemplate("example.com A=*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, err := OpenServers("127.0.0.1, ::1, 127.0.0.1", SourceOptions{
+		AllowSpecial: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Timeout = time.Second
+	opts.MaxAttempts = 1
+	var last Progress
+	opts.Progress = func(p Progress) { last = p }
+
+	results, err := Run(context.Background(), servers, tpl, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Result
+	for res := range results {
+		got = append(got, res)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 results (duplicate skipped), got %d", len(got))
+	}
+	for _, res := range got {
+		if res.Valid || res.FailedChecks != 1 || len(res.Checks) != 1 ||
+			res.Checks[0].Domain != "example.com" || res.Checks[0].Passed {
+			t.Errorf("unexpected result: %+v", res)
+		}
+	}
+	want := Progress{
+		TotalServers: 2, TotalKnown: true, InvalidServers: 2,
+		DoneChecks: 2, TotalChecks: 2, Requests: 2,
+	}
+	if last != want {
+		t.Errorf("final progress = %+v, want %+v", last, want)
+	}
+}
+
+func TestOpenServersOptions(t *testing.T) {
+	servers, err := OpenServers("192.0.2.0/29", SourceOptions{
+		MaxRangeSize: 8,
+		AllowSpecial: true,
+		Exclude:      []string{"192.0.2.0-192.0.2.3"},
+		Shard:        1,
+		NumShards:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.RateLimit = 0
+	opts.Resolver = ResolverFunc(func(
+		_ context.Context, domain, _ string, _ time.Duration,
+	) *Answer {
+		return &Answer{Domain: domain, Status: "REFUSED"}
+	})
+	results, err := Run(context.Background(), servers, DefaultTemplate(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range results {
+		n++
+	}
+	if n != 4 {
+		t.Errorf("expected 4 servers after exclusion, got %d", n)
+	}
+
+	for name, opts := range map[string]SourceOptions{
+		"bad exclude": {Exclude: []string{"not-an-ip"}},
+		"bad shard":   {Shard: 3, NumShards: 2},
+	} {
+		if _, err := OpenServers("192.0.2.1", opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var last Progress
+	opts := DefaultOptions()
+	opts.Progress = func(p Progress) { last = p }
+	results, err := Run(ctx, ServerList([]string{"127.0.0.1"}), DefaultTemplate(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range results {
+		t.Error("no result expected once ctx is done")
+	}
+	if last.UntestedServers != 1 {
+		t.Errorf("expected 1 untested server, got %+v", last)
+	}
+}
+
+func TestRunCustomResolver(t *testing.T) {
+	tpl, err := ParseTemplate("a.example NXDOMAIN\nb.example A=192.0.2.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	queries := map[string]int{}
+	opts := DefaultOptions()
+	opts.RateLimit = 0
+	opts.Resolver = ResolverFunc(func(
+		_ context.Context, domain, server string, _ time.Duration,
+	) *Answer {
+		mu.Lock()
+		queries[server]++
+		mu.Unlock()
+		ans := &Answer{Domain: domain, Status: "NXDOMAIN"}
+		if domain == "b.example" && server == "198.51.100.1" {
+			ans.Status, ans.A = "NOERROR", []string{"192.0.2.7"}
+		}
+		return ans
+	})
+	servers := ServerList([]string{"198.51.100.1", "198.51.100.2"})
+	results, err := Run(context.Background(), servers, tpl, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := map[string]bool{}
+	for res := range results {
+		valid[res.Server] = res.Valid
+	}
+	if !valid["198.51.100.1"] || valid["198.51.100.2"] || len(valid) != 2 {
+		t.Fatalf("unexpected verdicts: %v", valid)
+	}
+	if queries["198.51.100.1"] != 2 || queries["198.51.100.2"] < 1 {
+		t.Fatalf("unexpected queries: %v", queries)
+	}
+}
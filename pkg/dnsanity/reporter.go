@@ -0,0 +1,121 @@
+package dnsanity
+
+import (
+	"context"
+	"time"
+
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/dnsanitize"
+)
+
+var _ dnsanitize.Reporter = (*reporter)(nil)
+
+// reporter implements dnsanitize.Reporter: it sends results to a
+// channel, and reports progress through a callback.
+// All methods are single-goroutine – no mutex needed.
+type reporter struct {
+	ctx          context.Context
+	results      chan<- Result
+	numChecks    int
+	onProgress   func(Progress)
+	interval     time.Duration
+	lastProgress time.Time
+	progress     Progress
+}
+
+func newReporter(
+	ctx context.Context,
+	set *config.Settings,
+	results chan<- Result,
+	opts Options,
+) *reporter {
+	numServers, known := set.NumServers()
+	return &reporter{
+		ctx:        ctx,
+		results:    results,
+		numChecks:  len(set.Template),
+		onProgress: opts.Progress,
+		interval:   opts.ProgressInterval,
+		progress: Progress{
+			TotalServers: numServers,
+			TotalKnown:   known,
+			TotalChecks:  numServers * len(set.Template),
+		},
+	}
+}
+
+// sendProgress calls the Progress callback (if any).
+func (r *reporter) sendProgress() {
+	if r.onProgress != nil {
+		r.lastProgress = time.Now()
+		r.onProgress(r.progress)
+	}
+}
+
+// maybeSendProgress calls the Progress callback if interval elapsed.
+func (r *reporter) maybeSendProgress() {
+	if r.onProgress != nil && time.Since(r.lastProgress) >= r.interval {
+		r.sendProgress()
+	}
+}
+
+func (r *reporter) AddTotalServers(n int, known bool) {
+	r.progress.TotalServers += n
+	r.progress.TotalKnown = known
+	r.progress.TotalChecks += n * r.numChecks
+	r.maybeSendProgress()
+}
+
+func (r *reporter) AddDoneChecks(addDoneChecks, addTotalChecks int) {
+	r.progress.DoneChecks += addDoneChecks
+	r.progress.TotalChecks += addTotalChecks
+	r.maybeSendProgress()
+}
+
+func (r *reporter) AddSavedQueries(n int) {}
+
+func (r *reporter) AddUntestedServers(n int) {
+	r.progress.UntestedServers += n
+}
+
+func (r *reporter) ReportUntestedServer(srv *dns.ServerContext) {}
+
+func (r *reporter) ReportFinishedServer(srv *dns.ServerContext) {
+	if srv.Disabled {
+		r.progress.InvalidServers++
+	} else {
+		r.progress.ValidServers++
+	}
+	res := Result{
+		Server:       srv.IPAddress,
+		Valid:        !srv.Disabled,
+		FailedChecks: srv.FailedCount,
+		Score:        srv.Score(),
+		Checks:       make([]CheckResult, len(srv.Checks)),
+	}
+	for i, chk := range srv.Checks {
+		res.Checks[i] = CheckResult{
+			Domain: chk.Answer.Domain,
+			Status: chk.Answer.Status,
+			A:      chk.Answer.A,
+			CNAME:  chk.Answer.CNAME,
+			Passed: chk.Passed,
+		}
+	}
+	select {
+	case r.results <- res:
+	case <-r.ctx.Done(): // reader may be gone
+	}
+	r.maybeSendProgress()
+}
+
+func (r *reporter) LogRequests(t time.Time, nIdle, nBusy int) {
+	r.progress.Requests += nIdle + nBusy
+}
+
+func (r *reporter) UpdateBusyJobs(n int) {}
+
+func (r *reporter) UpdatePoolSize(n int) {}
+
+func (r *reporter) Debug(format string, args ...interface{}) {}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	// standard
+	"flag"
+	"fmt"
+	"os"
+	// external
+	// local
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/tty"
+)
+
+const templateCmdUsage = "Usage: dnsanity template lint [-min-entries int] [FILE]...\n"
+
+// runTemplateCmd implements `dnsanity template <action>` and returns
+// the process exit code.
+func runTemplateCmd(args []string) int {
+	if len(args) == 0 || args[0] != "lint" {
+		fmt.Fprint(os.Stderr, templateCmdUsage)
+		return 1
+	}
+	return lintTemplate(args[1:])
+}
+
+// lintTemplate reports suspicious template entries (with their position)
+// on STDOUT, and returns non-zero if anything was found.
+func lintTemplate(args []string) int {
+	fs := flag.NewFlagSet("template lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, templateCmdUsage)
+		fs.PrintDefaults()
+	}
+	minEntries := fs.Int("min-entries", 3, "minimum number of template entries")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	var tpl dns.Template
+	var err error
+	if fs.NArg() == 0 {
+		tpl, err = dns.NewTemplate(config.DEFAULT_TEMPLATE)
+	} else {
+		tpl, err = dns.NewTemplateFromFiles(fs.Args()...)
+	}
+	if err != nil {
+		tty.SmartFprintf(os.Stderr, "\033[1;31m[-] %v\033[0m\n", err)
+		return 1
+	}
+
+	issues := tpl.Lint(*minEntries)
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stdout, issue.String())
+	}
+	if len(issues) > 0 {
+		tty.SmartFprintf(
+			os.Stderr, "\033[1;31m[-] %d issue(s) found in %d entries\033[0m\n",
+			len(issues), len(tpl))
+		return 1
+	}
+	tty.SmartFprintf(
+		os.Stderr, "\033[1;32m[+] Template OK (%d entries)\033[0m\n", len(tpl))
+	return 0
+}
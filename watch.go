@@ -0,0 +1,118 @@
+package main
+
+import (
+	// standard
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	// external
+	// local
+	"github.com/nil0x42/dnsanity/internal/config"
+	"github.com/nil0x42/dnsanity/internal/dns"
+	"github.com/nil0x42/dnsanity/internal/report"
+	"github.com/nil0x42/dnsanity/internal/tty"
+)
+
+// watchMaxBackoff is the max number of cycles between two retries of a
+// failing server.
+const watchMaxBackoff = 32
+
+// watchServers re-runs the whole sanitization every -watch interval
+// until ctx is done, keeping -o file up to date with the healthy
+// servers, and returns the process exit code.
+func watchServers(ctx context.Context, conf *config.Config, ttyFile *os.File) int {
+	health := report.NewHealthSet(watchMaxBackoff)
+	template := conf.Template
+	for {
+		start := time.Now()
+		conf.Template = template // (-prune-template prunes it per cycle)
+		if err := watchCycle(ctx, conf, ttyFile, health); err != nil {
+			watchLog("\033[1;31m[-] cycle %d: %v, retrying in %v",
+				health.Cycle(), err, conf.Opts.Watch)
+		}
+		select {
+		case <-ctx.Done():
+			return exitCode(ctx)
+		case <-time.After(time.Until(start.Add(conf.Opts.Watch))):
+		}
+	}
+}
+
+// watchCycle validates the template, sanitizes the servers of -list
+// which are due, and updates -o file with the new healthy set.
+// On error, the healthy set is left untouched.
+func watchCycle(
+	ctx context.Context,
+	conf *config.Config,
+	ttyFile *os.File,
+	health *report.HealthSet,
+) error {
+	if conf.Differential { // learn fresh answers on each cycle
+		for i := range conf.Template {
+			conf.Template[i].ValidAnswers = nil
+		}
+	}
+	if !checkTemplate(ctx, conf, ttyFile) {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return errors.New("template validation failed")
+	}
+	// re-read -list, skipping failing servers until their backoff ends
+	source := conf.UntrustedDNS // 1st cycle: -list opened by config
+	conf.UntrustedDNS = nil
+	var err error
+	if source == nil {
+		listOpts := conf.ListOptions
+		listOpts.Skip = func(ip string) bool { return !health.Due(ip) }
+		source, err = config.OpenServerSource(conf.Opts.UntrustedDNS, listOpts)
+	}
+	if err != nil && !errors.Is(err, config.ErrEmptyList) {
+		return fmt.Errorf("-list: %w", err)
+	}
+	if err == nil { // (empty list: all servers are failing, or removed)
+		conf.UntrustedDNS = source
+		if conf.Opts.Prefilter {
+			err := prefilterServers(ctx, conf, ttyFile, func(ip string) {
+				health.Record(ip, false)
+			})
+			if err != nil { // (-list closed by prefilterServers)
+				conf.UntrustedDNS = nil
+				return fmt.Errorf("-prefilter: %w", err)
+			}
+		}
+		sanitizeServers(ctx, conf, ttyFile, func(srv *dns.ServerContext) {
+			health.Record(srv.IPAddress, !srv.Disabled)
+		})
+		conf.UntrustedDNS = nil
+		if ctx.Err() != nil {
+			return nil // interrupted: results are partial
+		}
+	}
+
+	cycle := health.Cycle()
+	added, removed := health.EndCycle()
+	if err := report.WriteFileAtomic(
+		conf.Opts.OutputFilePath, health.Healthy()); err != nil {
+		return fmt.Errorf("-o: %w", err)
+	}
+	watchLog("\033[1;34m[*] cycle %d: %d healthy servers (+%d, -%d), %d failing",
+		cycle, len(health.Healthy()), len(added), len(removed), health.NumFailing())
+	if cycle > 1 { // (don't flood the initial set)
+		for _, ip := range added {
+			watchLog("\033[1;32m[+] %s added", ip)
+		}
+		for _, ip := range removed {
+			watchLog("\033[1;31m[-] %s removed", ip)
+		}
+	}
+	return nil
+}
+
+// watchLog prints a timestamped -watch log line to STDERR.
+func watchLog(format string, args ...interface{}) {
+	tty.SmartFprintf(os.Stderr, "%s %s\033[0m\n",
+		time.Now().Format(time.DateTime), fmt.Sprintf(format, args...))
+}